@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"nobitex-sma-bot/internal/backtest"
+	"nobitex-sma-bot/internal/bot"
+	"nobitex-sma-bot/internal/nobitex"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backtestOptions are the backtest flags that are not part of backtest.Config.
+type backtestOptions struct {
+	configPath string
+	csvPath    string
+	resolution string
+	from       string
+	to         string
+	showTrades bool
+}
+
+// backtestFlags binds the backtest flags to cfg and opts.
+func backtestFlags(cfg *backtest.Config, opts *backtestOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	fs.StringVar(&opts.configPath, "config", opts.configPath, "take strategy and risk settings from a bot YAML config; other flags override it")
+	fs.StringVar(&opts.csvPath, "csv", "", "load candles from a CSV file instead of the Nobitex history API")
+	fs.StringVar(&opts.resolution, "resolution", opts.resolution, "candle resolution when fetching from the API")
+	fs.StringVar(&opts.from, "from", "", "start of the range (unix seconds, 2006-01-02 or RFC3339); default 24h before -to")
+	fs.StringVar(&opts.to, "to", "", "end of the range (unix seconds, 2006-01-02 or RFC3339); default now")
+	fs.BoolVar(&opts.showTrades, "trades", false, "print every simulated trade")
+	fs.StringVar(&cfg.Strategy, "strategy", cfg.Strategy, "entry strategy ("+strings.Join(bot.Strategies(), ", ")+")")
+	fs.Var(paramsFlag{&cfg.StrategyParams}, "param", "strategy-specific parameter as name=value (repeatable)")
+	fs.Float64Var(&cfg.PriceDeviation, "deviation", cfg.PriceDeviation, "entry deviation from the SMA")
+	fs.Float64Var(&cfg.ProfitTarget, "profit", cfg.ProfitTarget, "take-profit distance from entry")
+	fs.Float64Var(&cfg.StopLoss, "stop", cfg.StopLoss, "stop-loss distance from entry")
+	fs.IntVar(&cfg.Window, "window", cfg.Window, "number of candles fed to the strategy")
+	fs.Float64Var(&cfg.InitialBalance, "balance", cfg.InitialBalance, "starting margin balance")
+	fs.Float64Var(&cfg.Notional, "notional", cfg.Notional, "position size per entry")
+	fs.Float64Var(&cfg.Leverage, "leverage", cfg.Leverage, "margin leverage")
+	fs.Float64Var(&cfg.FeeRate, "fee", cfg.FeeRate, "fee rate charged on every fill")
+	fs.Float64Var(&cfg.Slippage, "slippage", cfg.Slippage, "adverse slippage on entries and stops")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go run ./cmd backtest [flags] <CurrencyPair>")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runBacktest implements `main.go backtest [flags] <CurrencyPair>`.
+func runBacktest(args []string) {
+	cfg := backtest.DefaultConfig()
+	opts := backtestOptions{resolution: bot.DefaultConfig().Strategy.Resolution}
+	fs := backtestFlags(&cfg, &opts)
+	_ = fs.Parse(args)
+
+	botCfg := bot.DefaultConfig()
+	if opts.configPath != "" {
+		var err error
+		if botCfg, err = bot.LoadConfig(opts.configPath); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		// Re-parse so that flags override the file.
+		cfg = backtest.FromBotConfig(botCfg)
+		opts.resolution = botCfg.Strategy.Resolution
+		fs = backtestFlags(&cfg, &opts)
+		_ = fs.Parse(args)
+	}
+
+	if fs.NArg() < 1 && opts.csvPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		bars []nobitex.Candle
+		err  error
+	)
+	if opts.csvPath != "" {
+		bars, err = backtest.LoadCSV(opts.csvPath)
+	} else {
+		end := time.Now()
+		if opts.to != "" {
+			if end, err = parseFlagTime(opts.to); err != nil {
+				log.Fatalf("Invalid -to: %v", err)
+			}
+		}
+		start := end.Add(-24 * time.Hour)
+		if opts.from != "" {
+			if start, err = parseFlagTime(opts.from); err != nil {
+				log.Fatalf("Invalid -from: %v", err)
+			}
+		}
+		client := nobitex.NewClient("")
+		client.BaseURL = botCfg.Endpoints.API
+		if baseURL := os.Getenv("NOBITEX_API_URL"); baseURL != "" {
+			client.BaseURL = baseURL
+		}
+		bars, err = backtest.LoadHistory(context.Background(), client, fs.Arg(0), opts.resolution, start.Unix(), end.Unix())
+	}
+	if err != nil {
+		log.Fatalf("Failed to load candles: %v", err)
+	}
+
+	report, err := backtest.Run(cfg, bars)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+	report.Print(os.Stdout, opts.showTrades)
+}
+
+func parseFlagTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// paramsFlag collects repeated name=value flags into a map.
+type paramsFlag struct {
+	params *map[string]float64
+}
+
+func (p paramsFlag) String() string {
+	if p.params == nil {
+		return ""
+	}
+	return fmt.Sprint(*p.params)
+}
+
+func (p paramsFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %v", name, err)
+	}
+	if *p.params == nil {
+		*p.params = make(map[string]float64)
+	}
+	(*p.params)[strings.TrimSpace(name)] = v
+	return nil
+}
@@ -1,18 +1,124 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"nobitex-sma-bot/internal/bot"
+	"nobitex-sma-bot/internal/logs"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/paper"
+	"nobitex-sma-bot/internal/store"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
 
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go <CurrencyPair>")
+	if len(os.Args) > 1 && os.Args[1] == "backtest" {
+		runBacktest(os.Args[2:])
+		return
+	}
+
+	configPath := flag.String("config", "", "path to a YAML config file")
+	resetHalt := flag.Bool("reset-halt", false, "lift a loss-limit halt saved by a previous run")
+	applyFlags := bot.BindConfigFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: go run ./cmd [flags] [CurrencyPair...] | backtest [flags] <CurrencyPair>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg := loadConfig(*configPath, applyFlags, flag.Args())
+
+	client := bot.NewNobitexClient(cfg, !cfg.Paper.Enabled)
+	var exchange bot.Exchange = client
+	if cfg.Paper.Enabled {
+		paperLogger, err := logs.Filelogger(cfg.Logging.Dir, "paper.log", logrus.InfoLevel)
+		if err != nil {
+			log.Fatalf("Failed to create paper logger: %v", err)
+		}
+		defer logs.Close(paperLogger)
+		exchange = paper.New(client, paper.Config{
+			Balance: cfg.Paper.Balance,
+			FeeRate: cfg.Paper.FeeRate,
+			Logger:  paperLogger,
+		})
+	}
+
+	// Paper trading keeps its own state so it never reconciles against
+	// (or cancels) orders that belong to a live run.
+	statePath := cfg.State.Path
+	if cfg.Paper.Enabled {
+		statePath = filepath.Join(filepath.Dir(statePath), "paper-"+filepath.Base(statePath))
+	}
+	st, err := store.Open(statePath)
+	if err != nil {
+		log.Fatalf("Failed to open state store: %v", err)
+	}
+	defer st.Close()
+
+	if *resetHalt {
+		rec, err := bot.ResetHalt(st)
+		if err != nil {
+			log.Fatalf("Failed to reset loss-limit halt: %v", err)
+		}
+		log.Printf("Loss-limit halt cleared (daily PnL %.0f, total PnL %.0f)", rec.DailyPnL, rec.TotalPnL)
 	}
-	currencyPair := os.Args[1]
 
-	tradingBot := bot.NewTradingBot(currencyPair)
-	tradingBot.Run()
+	// The first SIGINT/SIGTERM starts a graceful shutdown; a second one kills
+	// the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		log.Println("Shutting down; send the signal again to exit immediately")
+	}()
+
+	bot.RunPairs(ctx, exchange, cfg, st)
+	logRateLimitStats(client)
+}
+
+// logRateLimitStats reports the endpoint groups whose calls were throttled or
+// refused with 429 during the run.
+func logRateLimitStats(client *nobitex.Client) {
+	if client.Limiter == nil {
+		return
+	}
+	for group, s := range client.Limiter.Stats() {
+		if s.Throttled > 0 || s.RateLimited > 0 {
+			log.Printf("Rate limit %s: %d requests, %d throttled for %v in total, %d rate limited, %d retried",
+				group, s.Requests, s.Throttled, s.Waited.Round(time.Millisecond), s.RateLimited, s.Retries)
+		}
+	}
+}
+
+// loadConfig loads the config file (config.yaml in the working directory when
+// no path is given and it exists), applies flag overrides and validates.
+// Pairs given on the command line replace the configured ones.
+func loadConfig(path string, applyFlags func(*bot.Config), pairs []string) bot.Config {
+	if path == "" {
+		if _, err := os.Stat("config.yaml"); err == nil {
+			path = "config.yaml"
+		}
+	}
+	cfg, err := bot.LoadConfig(path)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	applyFlags(&cfg)
+	if len(pairs) > 0 {
+		cfg.SetPairs(pairs)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config:\n%v", err)
+	}
+	return cfg
 }
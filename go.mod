@@ -6,6 +6,8 @@ require (
 	github.com/centrifugal/centrifuge-go v0.10.3
 	github.com/joho/godotenv v1.5.1
 	github.com/sirupsen/logrus v1.9.3
+	go.etcd.io/bbolt v1.3.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
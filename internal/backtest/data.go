@@ -0,0 +1,117 @@
+package backtest
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// LoadHistory fetches candles from /market/udf/history, in as many requests
+// as the range needs.
+func LoadHistory(ctx context.Context, client *nobitex.Client, symbol, resolution string, from, to int64) ([]nobitex.Candle, error) {
+	return client.GetOHLCVData(ctx, symbol, resolution, from, to)
+}
+
+// LoadCSV reads candles from a CSV file. Columns are time,open,high,low,close
+// and an optional volume; a header row naming them (time/t, open/o, high/h,
+// low/l, close/c, volume/v) may reorder them. Time is unix seconds or RFC3339.
+func LoadCSV(path string) ([]nobitex.Candle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV: %w", err)
+	}
+	defer f.Close()
+	return readCSV(f)
+}
+
+func readCSV(r io.Reader) ([]nobitex.Candle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV is empty")
+	}
+
+	cols := map[string]int{"time": 0, "open": 1, "high": 2, "low": 3, "close": 4, "volume": 5}
+	if _, err := parseTime(records[0][0]); err != nil {
+		cols = headerColumns(records[0])
+		records = records[1:]
+	}
+	for _, name := range []string{"time", "open", "high", "low", "close"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("CSV is missing a %q column", name)
+		}
+	}
+
+	bars := make([]nobitex.Candle, 0, len(records))
+	for i, rec := range records {
+		field := func(name string) (float64, error) {
+			idx, ok := cols[name]
+			if !ok || idx >= len(rec) {
+				return 0, nil
+			}
+			return strconv.ParseFloat(strings.TrimSpace(rec[idx]), 64)
+		}
+
+		var bar nobitex.Candle
+		if cols["time"] >= len(rec) {
+			return nil, fmt.Errorf("CSV row %d: too few columns", i+1)
+		}
+		if bar.Time, err = parseTime(rec[cols["time"]]); err != nil {
+			return nil, fmt.Errorf("CSV row %d: %w", i+1, err)
+		}
+		for _, f := range []struct {
+			name string
+			dst  *float64
+		}{
+			{"open", &bar.Open}, {"high", &bar.High}, {"low", &bar.Low},
+			{"close", &bar.Close}, {"volume", &bar.Volume},
+		} {
+			if *f.dst, err = field(f.name); err != nil {
+				return nil, fmt.Errorf("CSV row %d: bad %s: %w", i+1, f.name, err)
+			}
+		}
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
+
+func headerColumns(header []string) map[string]int {
+	aliases := map[string]string{
+		"t": "time", "timestamp": "time", "date": "time",
+		"o": "open", "h": "high", "l": "low", "c": "close", "v": "volume",
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		cols[name] = i
+	}
+	return cols
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q", s)
+	}
+	return t, nil
+}
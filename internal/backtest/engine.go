@@ -0,0 +1,222 @@
+package backtest
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"nobitex-sma-bot/internal/bot"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// Config holds the strategy parameters and the simulated fill model.
+type Config struct {
+	// Strategy parameters, as in bot.Config.
+	Strategy       string
+	StrategyParams map[string]float64
+	PriceDeviation float64
+	ProfitTarget   float64
+	StopLoss       float64
+	Window         int // candles fed to the strategy
+
+	// Account and fill model.
+	InitialBalance float64 // starting margin balance
+	Notional       float64 // position size per entry, like risk.min_balance
+	Leverage       float64
+	FeeRate        float64 // charged on the notional of every fill
+	Slippage       float64 // adverse fraction applied to entry and stop fills
+}
+
+// DefaultConfig mirrors the live bot's default configuration.
+func DefaultConfig() Config {
+	return FromBotConfig(bot.DefaultConfig())
+}
+
+// FromBotConfig takes the strategy and risk settings of a live bot config.
+func FromBotConfig(c bot.Config) Config {
+	return Config{
+		Strategy:       c.Strategy.Name,
+		StrategyParams: c.Strategy.Params,
+		PriceDeviation: c.Strategy.PriceDeviation,
+		ProfitTarget:   c.Risk.ProfitTarget,
+		StopLoss:       c.Risk.StopLoss,
+		Window:         c.Strategy.Window,
+		InitialBalance: c.Risk.MinBalance,
+		Notional:       c.Risk.MinBalance,
+		Leverage:       c.Risk.Leverage,
+		FeeRate:        c.Paper.FeeRate,
+	}
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Window <= 0:
+		return fmt.Errorf("window must be positive, got %d", c.Window)
+	case c.ProfitTarget <= 0:
+		return fmt.Errorf("profit target must be positive, got %v", c.ProfitTarget)
+	case c.StopLoss <= 0:
+		return fmt.Errorf("stop loss must be positive, got %v", c.StopLoss)
+	case c.Leverage < 1:
+		return fmt.Errorf("leverage must be at least 1, got %v", c.Leverage)
+	case c.StopLoss >= 1/c.Leverage:
+		return fmt.Errorf("stop loss %v is beyond liquidation at %vx leverage", c.StopLoss, c.Leverage)
+	case c.InitialBalance <= 0 || c.Notional <= 0:
+		return fmt.Errorf("balance and notional must be positive")
+	}
+	return nil
+}
+
+// position is the single open position of the simulated account.
+type position struct {
+	side       string
+	entryTime  time.Time
+	entryPrice float64
+	amount     float64
+	entryFee   float64
+	takeProfit float64
+	stopLoss   float64
+}
+
+// Run replays bars through the configured bot.Strategy, fed the candles up to
+// each bar with the close as both bid and ask, and the live exit rule
+// (bot.ExitPrices as an OCO), one position at a time, and reports the result.
+//
+// Entries fill at the signal bar's close. On each later bar the stop is checked
+// before the take-profit, so a bar that spans both counts as a loss.
+func Run(cfg Config, bars []nobitex.Candle) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(bars) <= cfg.Window {
+		return nil, fmt.Errorf("need more than %d bars, got %d", cfg.Window, len(bars))
+	}
+	strategy, err := bot.NewStrategy(cfg.Strategy, bot.StrategyConfig{
+		Window:         cfg.Window,
+		PriceDeviation: cfg.PriceDeviation,
+		Params:         cfg.StrategyParams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Config: cfg, Bars: len(bars), barLength: medianSpacing(bars)}
+	balance := cfg.InitialBalance
+	var pos *position
+
+	closePosition := func(bar nobitex.Candle, price float64, reason string) {
+		exitFee := pos.amount * price * cfg.FeeRate
+		pnl := pos.amount * (price - pos.entryPrice)
+		if pos.side == "sell" {
+			pnl = -pnl
+		}
+		pnl -= pos.entryFee + exitFee
+		balance += pnl
+		report.Trades = append(report.Trades, Trade{
+			Side:       pos.side,
+			EntryTime:  pos.entryTime,
+			EntryPrice: pos.entryPrice,
+			ExitTime:   bar.Time,
+			ExitPrice:  price,
+			Amount:     pos.amount,
+			Fees:       pos.entryFee + exitFee,
+			PnL:        pnl,
+			Reason:     reason,
+		})
+		pos = nil
+	}
+
+	for i := cfg.Window - 1; i < len(bars); i++ {
+		bar := bars[i]
+
+		if pos != nil {
+			if price, reason, ok := exitFill(pos, bar, cfg.Slippage); ok {
+				closePosition(bar, price, reason)
+			}
+		}
+
+		if pos == nil && balance > 0 {
+			signal := strategy.Evaluate(bot.MarketState{
+				Candles:  bars[:i+1],
+				BidBest:  bar.Close,
+				AskBest:  bar.Close,
+				Position: bot.PositionState{Available: balance},
+			})
+			if side := signal.Action.Side(); side != "" {
+				price := bar.Close * (1 + cfg.Slippage)
+				if side == "sell" {
+					price = bar.Close * (1 - cfg.Slippage)
+				}
+				notional := min(cfg.Notional, balance*cfg.Leverage)
+				if signal.Size > 0 {
+					notional = min(signal.Size, notional)
+				}
+				tp, sl := bot.ExitPrices(side, price, price, price, cfg.ProfitTarget, cfg.StopLoss)
+				pos = &position{
+					side:       side,
+					entryTime:  bar.Time,
+					entryPrice: price,
+					amount:     notional / price,
+					entryFee:   notional * cfg.FeeRate,
+					takeProfit: tp,
+					stopLoss:   sl,
+				}
+			}
+		}
+
+		equity := balance
+		if pos != nil {
+			equity += pos.unrealized(bar.Close)
+		}
+		report.Equity = append(report.Equity, EquityPoint{Time: bar.Time, Equity: equity})
+	}
+
+	if pos != nil {
+		last := bars[len(bars)-1]
+		closePosition(last, last.Close, "end_of_data")
+		report.Equity[len(report.Equity)-1].Equity = balance
+	}
+
+	report.finalize()
+	return report, nil
+}
+
+// exitFill reports whether bar triggers the position's OCO and at what price.
+func exitFill(pos *position, bar nobitex.Candle, slippage float64) (float64, string, bool) {
+	switch pos.side {
+	case "buy":
+		if bar.Low <= pos.stopLoss {
+			return min(pos.stopLoss, bar.Open) * (1 - slippage), "stop_loss", true
+		}
+		if bar.High >= pos.takeProfit {
+			return max(pos.takeProfit, bar.Open), "take_profit", true
+		}
+	case "sell":
+		if bar.High >= pos.stopLoss {
+			return max(pos.stopLoss, bar.Open) * (1 + slippage), "stop_loss", true
+		}
+		if bar.Low <= pos.takeProfit {
+			return min(pos.takeProfit, bar.Open), "take_profit", true
+		}
+	}
+	return 0, "", false
+}
+
+func (p *position) unrealized(price float64) float64 {
+	pnl := p.amount * (price - p.entryPrice)
+	if p.side == "sell" {
+		pnl = -pnl
+	}
+	return pnl - p.entryFee
+}
+
+func medianSpacing(bars []nobitex.Candle) time.Duration {
+	if len(bars) < 2 {
+		return 0
+	}
+	gaps := make([]time.Duration, 0, len(bars)-1)
+	for i := 1; i < len(bars); i++ {
+		gaps = append(gaps, bars[i].Time.Sub(bars[i-1].Time))
+	}
+	slices.Sort(gaps)
+	return gaps[len(gaps)/2]
+}
@@ -0,0 +1,118 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Trade is one round trip of the simulated account.
+type Trade struct {
+	Side       string
+	EntryTime  time.Time
+	EntryPrice float64
+	ExitTime   time.Time
+	ExitPrice  float64
+	Amount     float64
+	Fees       float64
+	PnL        float64
+	Reason     string
+}
+
+// EquityPoint is the marked-to-market account value at a bar's close.
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// Report summarizes a backtest run.
+type Report struct {
+	Config Config
+	Bars   int
+	Trades []Trade
+	Equity []EquityPoint
+
+	TotalPnL    float64
+	ReturnPct   float64
+	WinRate     float64
+	MaxDrawdown float64 // fraction of the equity peak
+	Sharpe      float64 // annualized from per-bar equity returns
+
+	barLength time.Duration
+}
+
+func (r *Report) finalize() {
+	wins := 0
+	for _, t := range r.Trades {
+		r.TotalPnL += t.PnL
+		if t.PnL > 0 {
+			wins++
+		}
+	}
+	if len(r.Trades) > 0 {
+		r.WinRate = float64(wins) / float64(len(r.Trades))
+	}
+	r.ReturnPct = r.TotalPnL / r.Config.InitialBalance * 100
+
+	peak := r.Config.InitialBalance
+	returns := make([]float64, 0, len(r.Equity))
+	prev := r.Config.InitialBalance
+	for _, p := range r.Equity {
+		peak = max(peak, p.Equity)
+		if peak > 0 {
+			r.MaxDrawdown = max(r.MaxDrawdown, (peak-p.Equity)/peak)
+		}
+		if prev != 0 {
+			returns = append(returns, p.Equity/prev-1)
+		}
+		prev = p.Equity
+	}
+	r.Sharpe = sharpe(returns, r.barLength)
+}
+
+// sharpe annualizes the mean/stddev ratio of per-bar returns, assuming a zero
+// risk-free rate and round-the-clock trading.
+func sharpe(returns []float64, barLength time.Duration) float64 {
+	if len(returns) < 2 || barLength <= 0 {
+		return 0
+	}
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+	barsPerYear := float64(365*24*time.Hour) / float64(barLength)
+	return mean / std * math.Sqrt(barsPerYear)
+}
+
+// Print writes a human-readable summary, and the trade list when trades is set.
+func (r *Report) Print(w io.Writer, trades bool) {
+	if trades {
+		fmt.Fprintf(w, "%-5s %-20s %14s %-20s %14s %12s %16s  %s\n",
+			"side", "entry_time", "entry_price", "exit_time", "exit_price", "fees", "pnl", "reason")
+		for _, t := range r.Trades {
+			fmt.Fprintf(w, "%-5s %-20s %14.2f %-20s %14.2f %12.0f %16.0f  %s\n",
+				t.Side, t.EntryTime.UTC().Format("2006-01-02 15:04:05"), t.EntryPrice,
+				t.ExitTime.UTC().Format("2006-01-02 15:04:05"), t.ExitPrice, t.Fees, t.PnL, t.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Bars:          %d\n", r.Bars)
+	fmt.Fprintf(w, "Trades:        %d\n", len(r.Trades))
+	fmt.Fprintf(w, "Total PnL:     %.0f\n", r.TotalPnL)
+	fmt.Fprintf(w, "Return:        %.2f%%\n", r.ReturnPct)
+	fmt.Fprintf(w, "Win rate:      %.2f%%\n", r.WinRate*100)
+	fmt.Fprintf(w, "Max drawdown:  %.2f%%\n", r.MaxDrawdown*100)
+	fmt.Fprintf(w, "Sharpe:        %.2f\n", r.Sharpe)
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"sync"
+)
+
+// Allocator divides the balance of one margin wallet (RLS or USDT) between the
+// pairs quoted in it so that concurrent entry loops cannot over-commit it.
+//
+// Each pair's budget is its weighted share of the total capital (free balance
+// plus everything already committed by all pairs), clamped to its cap.
+// Committed capital is the exposure reported from open positions, plus
+// reservations held by in-flight entry loops, plus released reservations that
+// have not yet shown up as exposure.
+type Allocator struct {
+	mu          sync.Mutex
+	weights     map[string]float64
+	caps        map[string]float64
+	totalWeight float64
+
+	exposure map[string]float64
+	reserved map[string]float64
+	settling map[string]float64
+}
+
+// NewAllocator creates an allocator for the configured pairs. cfg must
+// already be validated.
+func NewAllocator(cfg Config) *Allocator {
+	a := &Allocator{
+		weights:  make(map[string]float64),
+		caps:     make(map[string]float64),
+		exposure: make(map[string]float64),
+		reserved: make(map[string]float64),
+		settling: make(map[string]float64),
+	}
+	for _, p := range cfg.Pairs {
+		a.weights[p.Symbol] = p.Weight
+		a.caps[p.Symbol] = cfg.pairCap(p)
+		a.totalWeight += p.Weight
+	}
+	return a
+}
+
+// Reserve claims up to want, in the wallet's currency, for a new entry on pair, given the current
+// free balance of the margin wallet. It returns the amount granted, or zero
+// when less than minimum is available; every non-zero grant must be given
+// back with Release.
+func (a *Allocator) Reserve(pair string, want, balance, minimum float64) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	weight, ok := a.weights[pair]
+	if !ok || want <= 0 {
+		return 0
+	}
+
+	var committed, pending float64
+	for p := range a.weights {
+		committed += a.committed(p)
+		pending += a.reserved[p] + a.settling[p]
+	}
+
+	share := min(a.caps[pair], (balance+committed)*weight/a.totalWeight)
+	// Reservations may not be reflected in the wallet's free balance yet.
+	grant := min(want, share-a.committed(pair), balance-pending)
+	if grant <= 0 || grant < minimum {
+		return 0
+	}
+	a.reserved[pair] += grant
+	return grant
+}
+
+// Release ends a reservation once its entry loop has finished. The amount
+// keeps counting as committed until the next SetExposure for the pair, so a
+// freshly filled position is not double-counted or forgotten in between.
+func (a *Allocator) Release(pair string, amount float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.reserved[pair] = max(a.reserved[pair]-amount, 0)
+	a.settling[pair] += amount
+}
+
+// SetExposure records the notional currently held in pair's open positions.
+func (a *Allocator) SetExposure(pair string, exposure float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.exposure[pair] = exposure
+	a.settling[pair] = 0
+}
+
+// Remaining reports how much more pair could commit before hitting its cap,
+// ignoring the shared balance.
+func (a *Allocator) Remaining(pair string) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return max(a.caps[pair]-a.committed(pair), 0)
+}
+
+// Equity is the free balance plus everything committed by all pairs.
+func (a *Allocator) Equity(balance float64) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	equity := balance
+	for p := range a.weights {
+		equity += a.committed(p)
+	}
+	return equity
+}
+
+func (a *Allocator) committed(pair string) float64 {
+	return a.exposure[pair] + a.reserved[pair] + a.settling[pair]
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"time"
+
+	"nobitex-sma-bot/internal/indicators"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// candleATR follows the ATR of the strategy's candles. Each closed candle is
+// fed to a streaming indicators.ATR once, instead of the ATR being rebuilt
+// from the whole window on every pass.
+type candleATR struct {
+	period    int
+	atr       *indicators.ATR
+	last      time.Time // open time of the last candle fed
+	lastClose float64
+}
+
+func newCandleATR(period int) *candleATR {
+	return &candleATR{period: period}
+}
+
+// update feeds the closed candles newer than the last one fed. The last
+// candle is still forming and is left out. If candles no longer line up with
+// what was fed, after a gap or a revised bar, the ATR starts over from them.
+func (a *candleATR) update(candles []nobitex.Candle) {
+	if a == nil {
+		return
+	}
+	closed := candles[:max(len(candles)-1, 0)]
+	if len(closed) == 0 {
+		return
+	}
+	start := 0
+	if a.atr != nil {
+		start = -1
+		for i, c := range closed {
+			if c.Time.Equal(a.last) && c.Close == a.lastClose {
+				start = i + 1
+				break
+			}
+		}
+	}
+	if start < 0 {
+		a.atr = nil
+		start = 0
+	}
+	if a.atr == nil {
+		a.atr = indicators.NewATR(a.period)
+	}
+	for _, c := range closed[start:] {
+		a.atr.Update(c.High, c.Low, c.Close)
+		a.last, a.lastClose = c.Time, c.Close
+	}
+}
+
+// value returns the ATR once period candles have been fed, or 0.
+func (a *candleATR) value() float64 {
+	if a == nil || a.atr == nil || !a.atr.Ready() {
+		return 0
+	}
+	return a.atr.Value()
+}
+
+// updateATR feeds new candles to the ATRs of the "atr" trailing mode and the
+// "volatility" sizing mode.
+func (bot *TradingBot) updateATR(candles []nobitex.Candle) {
+	bot.sizeATR.update(candles)
+	if bot.trailATR == nil {
+		return
+	}
+	bot.trailATR.update(candles)
+	bot.exitMu.Lock()
+	bot.atr = bot.trailATR.value()
+	bot.exitMu.Unlock()
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"nobitex-sma-bot/internal/indicators"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// testCandles returns n one-minute candles from start with varied ranges.
+func testCandles(start time.Time, n int) []nobitex.Candle {
+	candles := make([]nobitex.Candle, n)
+	for i := range candles {
+		p := 100 + 5*math.Sin(float64(i)/3)
+		candles[i] = nobitex.Candle{
+			Time:  start.Add(time.Duration(i) * time.Minute),
+			High:  p + 1 + float64(i%4),
+			Low:   p - 1,
+			Close: p + 0.5,
+		}
+	}
+	return candles
+}
+
+func recomputedATR(period int, candles []nobitex.Candle) float64 {
+	atr := indicators.NewATR(period)
+	for _, c := range candles {
+		atr.Update(c.High, c.Low, c.Close)
+	}
+	if !atr.Ready() {
+		return 0
+	}
+	return atr.Value()
+}
+
+func TestCandleATR(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	all := testCandles(start, 60)
+	const period, window = 5, 20
+
+	a := newCandleATR(period)
+	// Slide a window over the series as the candle buffer does; the last
+	// candle of each window is still forming.
+	for end := window; end <= len(all); end++ {
+		a.update(all[end-window : end])
+		if want := recomputedATR(period, all[:end-1]); math.Abs(a.value()-want) > 1e-9 {
+			t.Fatalf("window ending %d: ATR = %v, want %v", end, a.value(), want)
+		}
+	}
+
+	// The same candles again change nothing.
+	before := a.value()
+	a.update(all[len(all)-window:])
+	if a.value() != before {
+		t.Fatalf("ATR moved from %v to %v on repeated candles", before, a.value())
+	}
+
+	// After a gap the ATR starts over from the new window.
+	later := testCandles(start.Add(3*time.Hour), window)
+	a.update(later)
+	if want := recomputedATR(period, later[:window-1]); math.Abs(a.value()-want) > 1e-9 {
+		t.Fatalf("after a gap: ATR = %v, want %v", a.value(), want)
+	}
+
+	// So it does when the last bar fed was revised.
+	revised := append([]nobitex.Candle(nil), later...)
+	revised[window-2].Close += 3
+	a.update(revised)
+	if want := recomputedATR(period, revised[:window-1]); math.Abs(a.value()-want) > 1e-9 {
+		t.Fatalf("after a revised bar: ATR = %v, want %v", a.value(), want)
+	}
+}
+
+func TestCandleATRNotReady(t *testing.T) {
+	a := newCandleATR(14)
+	a.update(testCandles(time.Now(), 10))
+	if a.value() != 0 {
+		t.Fatalf("ATR = %v before 14 closed candles, want 0", a.value())
+	}
+	var unused *candleATR
+	unused.update(testCandles(time.Now(), 20))
+	if unused.value() != 0 {
+		t.Fatal("nil candleATR has a value")
+	}
+}
@@ -1,11 +1,13 @@
 package bot
 
 import (
-	"github.com/joho/godotenv"
+	"context"
 	"github.com/sirupsen/logrus"
 	"log"
 	"nobitex-sma-bot/internal/logs"
+	"nobitex-sma-bot/internal/markets"
 	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
 	"os"
 	"sync"
 	"time"
@@ -15,22 +17,15 @@ import (
 // Bot Struct
 // ----------------------------------------------------------------------------
 
-type (
-	// OrderBook carries the raw (string) bids/asks from the WebSocket
-	OrderBook struct {
-		Asks [][]string `json:"asks"`
-		Bids [][]string `json:"bids"`
-	}
-
-	// UpdatedOrderBook keeps numeric forms of bids/asks.
-	UpdatedOrderBook struct {
-		Asks [][2]float64
-		Bids [][2]float64
-	}
-)
 type TradingBot struct {
-	apiToken     string
+	cfg          Config
+	exchange     Exchange
+	allocator    *Allocator
+	guard        *LossGuard
+	markets      *markets.Registry
 	currencyPair string
+	amountStep   float64 // overrides the market's when set
+	strategy     Strategy
 
 	// Logging
 	openLogger  *logrus.Logger
@@ -39,21 +34,54 @@ type TradingBot struct {
 	// Position tracking
 	positionCount      int
 	balanceInPositions float64
+	knownPositions     map[int]bool // open in the last position list
 	posMutex           sync.Mutex
 
-	// WebSocket order book
-	orderBook       OrderBook
-	orderBookGlobal UpdatedOrderBook
+	// WebSocket order book, its freshness and the current subscription
+	orderBookGlobal nobitex.OrderBook
 	bookMutex       sync.Mutex
+	book            bookHealth
+	streamCancel    context.CancelFunc
+	streamMu        sync.Mutex
+
+	// Optional public trades and candle streams
+	tape    tradeTape
+	fills   *fillHints
+	candles candleBuffer
+
+	// Finished orders pushed by the private stream
+	orders *orderFeed
+
+	// Wakes entry loops waiting on a resting order: a book update, a trade
+	// through its price or a finished order event
+	entryWake broadcast
 
 	// Best bid/ask
 	bidBest float64
 	askBest float64
 	priceMu sync.RWMutex
 
-	// OCO tracking
-	ocoOrders map[int]bool
-	ocoMu     sync.Mutex
+	// Exit tracking: position ID -> its OCO legs, persisted in store
+	exits  map[int]*positionExits
+	atr    float64 // for ATR trailing stops
+	store  *store.Store
+	exitMu sync.Mutex
+
+	// ATRs of the strategy's candles, fed by the main loop; nil when unused
+	trailATR *candleATR // "atr" trailing mode
+	sizeATR  *candleATR // "volatility" sizing mode
+
+	// Set once the bot has acted on a loss-limit halt
+	halted bool
+
+	// Last strategy signal logged at info level
+	lastSignal string
+
+	// Wakes the main loop to re-evaluate the strategy
+	events *eventQueue
+
+	// Goroutines started by the bot; Run waits for them before returning
+	wg sync.WaitGroup
 
 	// Concurrency flags
 	buyOrderRunning  bool
@@ -70,10 +98,14 @@ type TradingBot struct {
 func (bot *TradingBot) setupLoggers() {
 	// Where we want to store logs
 
-	logDir := "log/" + bot.currencyPair
+	logDir := bot.cfg.Logging.Dir + "/" + bot.currencyPair
+	level, err := logrus.ParseLevel(bot.cfg.Logging.Level)
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
 
 	// Create 'open positions' logger
-	openLogger, err := logs.Filelogger(logDir, "positions_open.log", logrus.InfoLevel)
+	openLogger, err := logs.Filelogger(logDir, "positions_open.log", level)
 	if err != nil {
 
 		log.Fatalf("Failed to create openLogger: %v", err)
@@ -81,7 +113,7 @@ func (bot *TradingBot) setupLoggers() {
 	}
 
 	// Create 'close positions' logger
-	closeLogger, err := logs.Filelogger(logDir, "positions_close.log", logrus.InfoLevel)
+	closeLogger, err := logs.Filelogger(logDir, "positions_close.log", level)
 	if err != nil {
 
 		log.Fatalf("Failed to create closeLogger: %v", err)
@@ -91,115 +123,274 @@ func (bot *TradingBot) setupLoggers() {
 	bot.closeLogger = closeLogger
 }
 
-// NewTradingBot initializes the bot and sets up logging/env.
-func NewTradingBot(pair string) *TradingBot {
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: could not load .env file: %v", err)
-	}
+// NewNobitexClient builds a Nobitex client for the configured endpoints,
+// authenticated with NOBITEX_API_TOKEN. The token may be left unset when only
+// public market data is needed.
+func NewNobitexClient(cfg Config, requireToken bool) *nobitex.Client {
 	apiToken := os.Getenv("NOBITEX_API_TOKEN")
-	if apiToken == "" {
+	if apiToken == "" && requireToken {
 		log.Fatal("API token not found in environment variables")
 	}
 
+	client := nobitex.NewClient(apiToken)
+	client.BaseURL = cfg.Endpoints.API
+	client.StreamURL = cfg.Endpoints.Stream
+	return client
+}
+
+// NewTradingBot initializes the bot on top of the given exchange and sets up logging.
+// cfg must already be validated, allocator shared by every bot on the same
+// margin wallet, and guard, registry and st by every bot in the process.
+func NewTradingBot(pair string, exchange Exchange, cfg Config, allocator *Allocator, guard *LossGuard, registry *markets.Registry, st *store.Store) *TradingBot {
+	strategy, err := NewStrategy(cfg.Strategy.Name, cfg.Strategy.strategyConfig())
+	if err != nil {
+		log.Fatalf("Failed to create strategy: %v", err)
+	}
+
 	bot := &TradingBot{
-		apiToken:     apiToken,
-		currencyPair: pair,
-		ocoOrders:    make(map[int]bool),
+		cfg:            cfg,
+		exchange:       exchange,
+		allocator:      allocator,
+		guard:          guard,
+		markets:        registry,
+		currencyPair:   pair,
+		strategy:       strategy,
+		exits:          make(map[int]*positionExits),
+		store:          st,
+		events:         newEventQueue(),
+		fills:          newFillHints(),
+		orders:         newOrderFeed(),
+		knownPositions: make(map[int]bool),
+	}
+	if cfg.Trailing.Enabled && cfg.Trailing.Mode == "atr" {
+		bot.trailATR = newCandleATR(cfg.Trailing.ATRPeriod)
+	}
+	if cfg.Sizing.Mode == "volatility" {
+		bot.sizeATR = newCandleATR(cfg.Sizing.ATRPeriod)
+	}
+	bot.tape.window = cfg.Stream.TradeWindow
+	bot.candles.step, _ = nobitex.ResolutionDuration(cfg.Strategy.Resolution)
+	bot.candles.size = cfg.Strategy.Window
+	for _, p := range cfg.Pairs {
+		if p.Symbol == pair {
+			bot.amountStep = p.AmountStep
+		}
 	}
 	bot.setupLoggers()
 	return bot
 }
 
-// Run starts WebSocket subscription and enters the main trading loop.
-func (bot *TradingBot) Run() {
+// Run starts WebSocket subscription and enters the main trading loop. It
+// returns once ctx is cancelled and the bot has shut down.
+//
+// The strategy is evaluated when the best bid or ask moves, when a candle
+// closes and when positions change, after waiting Intervals.Debounce for
+// related events and at most once per Intervals.MinEval, unless the order
+// book is stale. With stream.candles set, candles come from the candle stream
+// and the history endpoint is only polled while the stream lags. Positions,
+// the loss guard, the balance and market rules are refreshed every
+// Intervals.Loop, and positions also as soon as the private stream reports a
+// fill.
+func (bot *TradingBot) Run(ctx context.Context) {
+	defer bot.shutdown()
 
-	go bot.WebSocketHandler()
-	time.Sleep(5 * time.Second) // Wait a bit for the order book to initialize
+	// Reconciliation filters positions by the currencies the markets list
+	// gives the pair.
+	bot.refreshMarkets(ctx)
+	bot.reconcile(ctx)
+
+	bot.WebSocketHandler(ctx)
+	if bot.cfg.Stream.Private {
+		bot.PrivateStreamHandler(ctx)
+	}
+	sleep(ctx, bot.cfg.Intervals.Warmup) // Wait a bit for the order book to initialize
+
+	bot.wg.Add(1)
+	go bot.candleClock(ctx)
+	ticker := time.NewTicker(bot.cfg.Intervals.Loop)
+	defer ticker.Stop()
+
+	var (
+		candles  []nobitex.Candle
+		balance  float64
+		halted   bool
+		lastEval time.Time
+	)
+	housekeep := func() {
+		bot.MonitorPositionsAndClose(ctx)
+		halted = bot.checkHalt(ctx)
+		bot.refreshMarkets(ctx)
+		if b, err := bot.exchange.GetAvailableBalance(ctx, bot.market().Dst); err != nil {
+			bot.openLogger.WithError(err).Error("Error fetching balance")
+		} else {
+			balance = b
+		}
+		bot.saveState()
+	}
+	housekeep()
+	bot.events.notify(candleEvent)
 
 	for {
-		bot.MonitorPositionsAndClose()
-		prices, err := bot.fetchOHLCVData()
-		if err != nil {
-			bot.openLogger.WithError(err).Error("Error fetching OHLCV data")
-			time.Sleep(5 * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			housekeep()
+			if candles == nil {
+				bot.events.notify(candleEvent)
+			}
 			continue
+		case <-bot.events.wake:
+		}
+
+		// Let a burst of events settle, and keep evaluations apart.
+		wait := max(bot.cfg.Intervals.Debounce, bot.cfg.Intervals.MinEval-time.Since(lastEval))
+		if wait > 0 && !sleep(ctx, wait) {
+			return
 		}
-		if len(prices) < Pastmin {
-			bot.openLogger.Info("Not enough data for SMA. Retrying...")
-			time.Sleep(5 * time.Second)
+		kind := bot.events.take()
+		if kind == 0 {
 			continue
 		}
-		sma := bot.calculateSMA(prices) * 10
-		balance, err := nobitex.GetAvailableBalance(bot.apiToken) // from your refactored code
+		if kind&fillEvent != 0 {
+			// Protect a freshly filled entry without waiting for the ticker.
+			bot.MonitorPositionsAndClose(ctx)
+		}
+		latest, err := bot.latestCandles(ctx, kind&candleEvent != 0 || candles == nil)
 		if err != nil {
-			bot.openLogger.WithError(err).Error("Error fetching balance")
-			time.Sleep(5 * time.Second)
+			bot.openLogger.WithError(err).Error("Error fetching OHLCV data")
+			candles = nil
 			continue
 		}
+		if latest != nil {
+			candles = scaleCandles(latest, bot.candleScale())
+			bot.updateATR(candles)
+		}
+		if halted || bot.bookStale() {
+			continue
+		}
+		lastEval = time.Now()
+		bot.evaluate(ctx, candles, balance)
+	}
+}
+
+// evaluate runs the strategy on the latest candles and top of book and starts
+// an entry loop on its signal.
+func (bot *TradingBot) evaluate(ctx context.Context, candles []nobitex.Candle, balance float64) {
+	bot.priceMu.RLock()
+	bidBest := bot.bidBest
+	askBest := bot.askBest
+	bot.priceMu.RUnlock()
+
+	bot.posMutex.Lock()
+	signal := bot.strategy.Evaluate(MarketState{
+		Candles: candles,
+		BidBest: bidBest,
+		AskBest: askBest,
+		Flow:    bot.tape.flow(time.Now()),
+		Position: PositionState{
+			Count:     bot.positionCount,
+			Exposure:  bot.balanceInPositions,
+			Available: balance,
+		},
+	})
+
+	fields := logrus.Fields{
+		"bidBest":  bidBest,
+		"askBest":  askBest,
+		"strategy": bot.strategy.Name(),
+		"signal":   signal.Action.String(),
+		"reason":   signal.Reason,
+	}
+	for k, v := range signal.Values {
+		fields[k] = v
+	}
+	if action := signal.Action.String(); action != bot.lastSignal {
+		bot.lastSignal = action
+		bot.openLogger.WithFields(fields).Info("Current price and signal")
+	} else {
+		bot.openLogger.WithFields(fields).Debug("Current price and signal")
+	}
+
+	want := bot.entrySize(balance, (bidBest+askBest)/2)
+	if signal.Size > 0 {
+		want = min(signal.Size, want)
+	}
+	rules := bot.marketRules()
+	if signal.Action != Flat && !bot.markets.Loaded(bot.currencyPair) {
+		bot.openLogger.WithField("signal", signal.Action.String()).Warn("Market rules not loaded yet; not opening a position")
+		signal.Action = Flat
+	}
+	if signal.Action != Flat && !rules.MarginEnabled {
+		bot.openLogger.WithField("signal", signal.Action.String()).Warn("Margin trading is not available on this market; not opening a position")
+		signal.Action = Flat
+	}
+	switch signal.Action {
+	case Long:
+		bot.buyOrderMu.Lock()
+		if !bot.buyOrderRunning {
+			size := bot.allocator.Reserve(bot.currencyPair, want, balance, rules.MinOrderValue)
+			if size > 0 {
+				bot.openLogger.WithFields(logrus.Fields{
+					"balance":       size,
+					"price":         bidBest,
+					"position_side": "buy(long)",
+					"reason":        signal.Reason,
+				}).Info("Opening BUY position")
 
-		bot.priceMu.RLock()
-		bidBest := bot.bidBest
-		askBest := bot.askBest
-		bot.priceMu.RUnlock()
-
-		bot.openLogger.WithFields(logrus.Fields{
-			"bidBest": bidBest,
-			"askBest": askBest,
-			"SMA":     sma,
-		}).Info("Current price and SMA")
-
-		bot.posMutex.Lock()
-		switch {
-		case bidBest <= sma*(1-PriceDeviation) && bot.balanceInPositions < MinBalance && balance > MinBalance:
-			bot.openLogger.WithFields(logrus.Fields{
-				"balance":       MinBalance - bot.balanceInPositions,
-				"price":         bidBest,
-				"position_side": "buy(long)",
-				"reason":        "price_below_sma_threshold",
-			}).Info("Opening BUY position")
-
-			bot.buyOrderMu.Lock()
-			if !bot.buyOrderRunning {
 				bot.buyOrderRunning = true
+				bot.wg.Add(1)
 				go func() {
+					defer bot.wg.Done()
 					defer func() {
+						bot.allocator.Release(bot.currencyPair, size)
 						bot.buyOrderMu.Lock()
 						bot.buyOrderRunning = false
 						bot.buyOrderMu.Unlock()
+						bot.events.notify(positionEvent)
 					}()
-					bot.PlaceBuyOrder(MinBalance-bot.balanceInPositions, bidBest)
+					bot.PlaceBuyOrder(ctx, size, bidBest)
 				}()
 			} else {
-				bot.openLogger.Warn("BuyOrder thread already running.")
+				bot.openLogger.WithField("balance", balance).Debug("No capital allocated for BUY position")
 			}
-			bot.buyOrderMu.Unlock()
-
-		case askBest >= sma*(1+PriceDeviation) && bot.balanceInPositions < MinBalance && balance > MinBalance:
-			bot.openLogger.WithFields(logrus.Fields{
-				"balance":       MinBalance - bot.balanceInPositions,
-				"price":         askBest,
-				"position_side": "sell(short)",
-				"reason":        "price_above_sma_threshold",
-			}).Info("Opening SELL position")
-
-			bot.sellOrderMu.Lock()
-			if !bot.sellOrderRunning {
+		} else {
+			bot.openLogger.Debug("BuyOrder thread already running.")
+		}
+		bot.buyOrderMu.Unlock()
+
+	case Short:
+		bot.sellOrderMu.Lock()
+		if !bot.sellOrderRunning {
+			size := bot.allocator.Reserve(bot.currencyPair, want, balance, rules.MinOrderValue)
+			if size > 0 {
+				bot.openLogger.WithFields(logrus.Fields{
+					"balance":       size,
+					"price":         askBest,
+					"position_side": "sell(short)",
+					"reason":        signal.Reason,
+				}).Info("Opening SELL position")
+
 				bot.sellOrderRunning = true
+				bot.wg.Add(1)
 				go func() {
+					defer bot.wg.Done()
 					defer func() {
+						bot.allocator.Release(bot.currencyPair, size)
 						bot.sellOrderMu.Lock()
 						bot.sellOrderRunning = false
 						bot.sellOrderMu.Unlock()
+						bot.events.notify(positionEvent)
 					}()
-					bot.PlaceSellOrder(MinBalance-bot.balanceInPositions, askBest)
+					bot.PlaceSellOrder(ctx, size, askBest)
 				}()
 			} else {
-				bot.openLogger.Warn("SellOrder thread already running.")
+				bot.openLogger.WithField("balance", balance).Debug("No capital allocated for SELL position")
 			}
-			bot.sellOrderMu.Unlock()
+		} else {
+			bot.openLogger.Debug("SellOrder thread already running.")
 		}
-		bot.posMutex.Unlock()
-
-		time.Sleep(5 * time.Second)
+		bot.sellOrderMu.Unlock()
 	}
+	bot.posMutex.Unlock()
 }
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// candleBuffer holds the strategy's candles as the candle stream updates
+// them, seeded from the history endpoint. Prices are as the exchange sends
+// them, before scaleCandles. Streamed bars are ignored until the first seed.
+type candleBuffer struct {
+	mu      sync.Mutex
+	step    time.Duration
+	size    int
+	seeded  bool
+	candles []nobitex.Candle
+}
+
+// seed replaces the buffer with candles fetched over REST, keeping a streamed
+// bar newer than the last of them.
+func (b *candleBuffer) seed(candles []nobitex.Candle) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var newer []nobitex.Candle
+	if n := len(b.candles); n > 0 && len(candles) > 0 && b.candles[n-1].Time.After(candles[len(candles)-1].Time) {
+		newer = b.candles[n-1:]
+	}
+	b.candles = append(append([]nobitex.Candle(nil), candles...), newer...)
+	b.seeded = true
+	b.trim()
+}
+
+// update applies a streamed bar: it replaces the bar with the same time or
+// starts a new one. It reports whether a new bar started, which closes the
+// previous one. Bars older than the last, or streamed before the buffer is
+// seeded, are ignored.
+func (b *candleBuffer) update(c nobitex.Candle) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.candles)
+	switch {
+	case !b.seeded:
+		return false
+	case n > 0 && c.Time.Equal(b.candles[n-1].Time):
+		b.candles[n-1] = c
+		return false
+	case n > 0 && c.Time.Before(b.candles[n-1].Time):
+		return false
+	}
+	b.candles = append(b.candles, c)
+	b.trim()
+	return n > 0
+}
+
+// fresh returns a copy of the candles if the buffer is seeded and the last
+// one opened less than two steps before now, or nil when the stream has
+// fallen behind.
+func (b *candleBuffer) fresh(now time.Time) []nobitex.Candle {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.candles)
+	if !b.seeded || n == 0 || now.Sub(b.candles[n-1].Time) >= 2*b.step {
+		return nil
+	}
+	return append([]nobitex.Candle(nil), b.candles...)
+}
+
+func (b *candleBuffer) trim() {
+	if extra := len(b.candles) - b.size; b.size > 0 && extra > 0 {
+		b.candles = append(b.candles[:0], b.candles[extra:]...)
+	}
+}
+
+// onCandle applies a streamed candle and wakes the main loop when one closes.
+func (bot *TradingBot) onCandle(c nobitex.Candle) {
+	if bot.candles.update(c) {
+		bot.events.notify(candleEvent)
+	}
+}
+
+// latestCandles returns the streamed candles while the stream keeps up.
+// Otherwise, when fetch is set, it fetches them from the history endpoint and
+// reseeds the buffer; when it is not, it returns nil.
+func (bot *TradingBot) latestCandles(ctx context.Context, fetch bool) ([]nobitex.Candle, error) {
+	if bot.cfg.Stream.Candles {
+		if candles := bot.candles.fresh(time.Now()); candles != nil {
+			return candles, nil
+		}
+	}
+	if !fetch {
+		return nil, nil
+	}
+	candles, err := bot.fetchOHLCVData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bot.cfg.Stream.Candles {
+		bot.candles.seed(candles)
+	}
+	return candles, nil
+}
@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+func TestCandleBufferStreamedBeforeSeed(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bar := func(i int) nobitex.Candle {
+		return nobitex.Candle{Time: start.Add(time.Duration(i) * time.Minute), Close: float64(100 + i)}
+	}
+	b := candleBuffer{step: time.Minute, size: 3}
+
+	// A bar streamed before the first fetch must not make the buffer fresh,
+	// or the history is never fetched.
+	if b.update(bar(4)) {
+		t.Fatal("unseeded update reported a closed bar")
+	}
+	if got := b.fresh(start.Add(4 * time.Minute)); got != nil {
+		t.Fatalf("fresh before seed = %+v, want nil", got)
+	}
+
+	b.seed([]nobitex.Candle{bar(1), bar(2), bar(3), bar(4)})
+	got := b.fresh(start.Add(4 * time.Minute))
+	if len(got) != 3 || !got[0].Time.Equal(bar(2).Time) || !got[2].Time.Equal(bar(4).Time) {
+		t.Fatalf("fresh after seed = %+v, want bars 2 to 4", got)
+	}
+
+	if !b.update(bar(5)) {
+		t.Fatal("a new bar after the seed did not close the previous one")
+	}
+	got = b.fresh(start.Add(5 * time.Minute))
+	if len(got) != 3 || !got[2].Time.Equal(bar(5).Time) {
+		t.Fatalf("fresh after update = %+v, want bars 3 to 5", got)
+	}
+	if got := b.fresh(start.Add(7 * time.Minute)); got != nil {
+		t.Fatalf("fresh after the stream fell behind = %+v, want nil", got)
+	}
+}
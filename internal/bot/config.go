@@ -1,11 +1,627 @@
 package bot
 
-// Trading parameters (tweak as needed)
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
 const (
-	PriceDeviation = 0.002
-	ProfitTarget   = 0.007
-	StopLoss       = 0.01
-	Leverage       = "3.0"
-	MinBalance     = 50000000.0
-	Pastmin        = 20
+	// ExchangeMaxLeverage is the highest margin leverage Nobitex offers.
+	ExchangeMaxLeverage = 5.0
+
+	// rialCandleScale converts /market/udf/history prices of IRT pairs
+	// (toman) to order book prices (rials).
+	rialCandleScale = 10
 )
+
+// Config is the bot's runtime configuration. It is loaded from a YAML file,
+// then overridden by environment variables and command-line flags.
+type Config struct {
+	Pairs       []PairSettings      `yaml:"pairs"`
+	Strategy    StrategySettings    `yaml:"strategy"`
+	Risk        RiskSettings        `yaml:"risk"`
+	Sizing      SizingSettings      `yaml:"sizing"`
+	Exits       ExitSettings        `yaml:"exits"`
+	Trailing    TrailingSettings    `yaml:"trailing"`
+	Limits      LimitSettings       `yaml:"limits"`
+	Liquidation LiquidationSettings `yaml:"liquidation"`
+	Intervals   IntervalSettings    `yaml:"intervals"`
+	Endpoints   EndpointSettings    `yaml:"endpoints"`
+	Logging     LoggingSettings     `yaml:"logging"`
+	State       StateSettings       `yaml:"state"`
+	Shutdown    ShutdownSettings    `yaml:"shutdown"`
+	Stream      StreamSettings      `yaml:"stream"`
+	Paper       PaperSettings       `yaml:"paper"`
+}
+
+// PairSettings is one market traded by the process and its share of capital.
+type PairSettings struct {
+	Symbol      string  `yaml:"symbol"`
+	Weight      float64 `yaml:"weight"`       // share of the margin balance relative to other pairs; default 1
+	MaxNotional float64 `yaml:"max_notional"` // cap on the quote currency committed; default the quote's minimum balance
+	AmountStep  float64 `yaml:"amount_step"`  // overrides the market's amount step when set
+}
+
+type StrategySettings struct {
+	Name           string             `yaml:"name"`
+	Window         int                `yaml:"window"`     // candles fed to the strategy
+	Resolution     string             `yaml:"resolution"` // UDF candle resolution
+	PriceDeviation float64            `yaml:"price_deviation"`
+	Params         map[string]float64 `yaml:"params"`
+}
+
+type RiskSettings struct {
+	ProfitTarget float64            `yaml:"profit_target"`
+	StopLoss     float64            `yaml:"stop_loss"`
+	Leverage     float64            `yaml:"leverage"`
+	MinBalance   float64            `yaml:"min_balance"`  // rials committed to positions per rial pair
+	MinBalances  map[string]float64 `yaml:"min_balances"` // the same for other quote currencies, e.g. usdt
+}
+
+// SizingSettings decide the notional in rials each entry commits. Whatever the
+// mode, the size is capped by MaxNotional and by what is left of the pair's
+// cap. Equity is the free margin balance plus everything committed by all
+// pairs.
+type SizingSettings struct {
+	Mode             string  `yaml:"mode"`              // fixed, equity, risk or volatility
+	Notional         float64 `yaml:"notional"`          // fixed: rials per entry; 0 fills the pair's cap
+	EquityFraction   float64 `yaml:"equity_fraction"`   // equity: share of equity per entry
+	RiskFraction     float64 `yaml:"risk_fraction"`     // risk: share of equity lost if risk.stop_loss is hit
+	VolatilityTarget float64 `yaml:"volatility_target"` // volatility: share of equity one ATR move is worth
+	ATRPeriod        int     `yaml:"atr_period"`        // volatility: candles in the ATR
+	MaxNotional      float64 `yaml:"max_notional"`      // cap per entry; 0 for none
+}
+
+// ExitSettings split each position's exit into take-profit tranches. The part
+// not covered by Tranches (the runner) is closed by an OCO at
+// risk.profit_target whose stop trails when trailing is enabled.
+type ExitSettings struct {
+	Tranches  []TrancheSettings `yaml:"tranches"`
+	BreakEven bool              `yaml:"break_even"` // after the first tranche fills, move the remaining stops to entry plus fees
+	FeeRate   float64           `yaml:"fee_rate"`   // round-trip fee allowance added to the break-even stop
+}
+
+type TrancheSettings struct {
+	Fraction float64 `yaml:"fraction"` // share of the position's liability
+	Profit   float64 `yaml:"profit"`   // take-profit distance from entry
+}
+
+// TrailingSettings ratchet each position's stop behind the best price since
+// entry, at Distance as a fraction of price ("percent") or as a multiple of
+// the candle ATR ("atr").
+type TrailingSettings struct {
+	Enabled   bool    `yaml:"enabled"`
+	Mode      string  `yaml:"mode"` // percent or atr
+	Distance  float64 `yaml:"distance"`
+	ATRPeriod int     `yaml:"atr_period"`
+	MinStep   float64 `yaml:"min_step"` // smallest stop move worth re-placing the OCO, as a fraction of price
+}
+
+// LimitSettings halt new entries on every pair once realized losses hit a
+// limit. A zero limit is disabled. The halt is persisted; a daily loss halt
+// lifts when the trading day ends, the others last until cleared with
+// -reset-halt.
+type LimitSettings struct {
+	MaxDailyLoss         float64 `yaml:"max_daily_loss"` // realized loss in one trading day, in the pairs' quote currency
+	MaxConsecutiveLosses int     `yaml:"max_consecutive_losses"`
+	MaxDrawdown          float64 `yaml:"max_drawdown"` // realized PnL given back from its peak, in the quote currency
+	Timezone             string  `yaml:"timezone"`     // where the trading day starts, e.g. UTC or Asia/Tehran
+	Flatten              bool    `yaml:"flatten"`      // close open positions when the halt trips
+}
+
+// LiquidationSettings watch how far each position is from its liquidation
+// price, as a fraction of the current price. A zero distance is disabled.
+type LiquidationSettings struct {
+	AlertDistance  float64 `yaml:"alert_distance"`  // log an alert this close to liquidation
+	ReduceDistance float64 `yaml:"reduce_distance"` // cut the position this close to liquidation
+	ReduceFraction float64 `yaml:"reduce_fraction"` // share of the liability closed per cut; 1 closes it all
+}
+
+type IntervalSettings struct {
+	Loop          time.Duration `yaml:"loop"`           // how often positions, the loss guard and the balance are refreshed
+	MinEval       time.Duration `yaml:"min_eval"`       // least time between two strategy evaluations
+	Debounce      time.Duration `yaml:"debounce"`       // wait for related events before evaluating
+	Warmup        time.Duration `yaml:"warmup"`         // wait for the order book before trading
+	PositionCheck time.Duration `yaml:"position_check"` // delay before checking whether a position closed
+	Markets       time.Duration `yaml:"markets"`        // how long fetched market rules are cached
+}
+
+type EndpointSettings struct {
+	API    string `yaml:"api"`
+	Stream string `yaml:"stream"`
+}
+
+type LoggingSettings struct {
+	Dir   string `yaml:"dir"` // logs go to <dir>/<pair>
+	Level string `yaml:"level"`
+}
+
+type StateSettings struct {
+	Path string `yaml:"path"` // bbolt database; paper mode uses a paper- prefixed file beside it
+}
+
+type ShutdownSettings struct {
+	Flatten bool          `yaml:"flatten"` // close open positions on exit
+	Timeout time.Duration `yaml:"timeout"` // budget for cancelling and flattening on exit
+}
+
+// StreamSettings decide when the order book counts as stale and how the
+// WebSocket is reconnected then, and which channels besides the order book
+// are subscribed.
+type StreamSettings struct {
+	StaleAfter   time.Duration `yaml:"stale_after"`   // no snapshot for this long makes the book stale
+	ReconnectMin time.Duration `yaml:"reconnect_min"` // first reconnect delay, doubling per attempt
+	ReconnectMax time.Duration `yaml:"reconnect_max"`
+
+	Trades      bool          `yaml:"trades"`       // feed trade flow to strategies and spot fills of resting entries
+	TradeWindow time.Duration `yaml:"trade_window"` // trades summed into MarketState.Flow
+	Candles     bool          `yaml:"candles"`      // build candles from the stream instead of polling history
+	Private     bool          `yaml:"private"`      // take order fills and cancellations from the private channels
+}
+
+type PaperSettings struct {
+	Enabled bool    `yaml:"enabled"`
+	Balance float64 `yaml:"balance"`
+	FeeRate float64 `yaml:"fee_rate"`
+}
+
+// DefaultConfig returns the settings the bot used before it was configurable.
+func DefaultConfig() Config {
+	return Config{
+		Strategy: StrategySettings{
+			Name:           "sma",
+			Window:         20,
+			Resolution:     "1",
+			PriceDeviation: 0.002,
+		},
+		Risk: RiskSettings{
+			ProfitTarget: 0.007,
+			StopLoss:     0.01,
+			Leverage:     3,
+			MinBalance:   50000000,
+		},
+		Sizing: SizingSettings{
+			Mode:             "fixed",
+			EquityFraction:   0.1,
+			RiskFraction:     0.01,
+			VolatilityTarget: 0.01,
+			ATRPeriod:        14,
+		},
+		Exits: ExitSettings{
+			FeeRate: 0.0026,
+		},
+		Trailing: TrailingSettings{
+			Mode:      "percent",
+			Distance:  0.005,
+			ATRPeriod: 14,
+			MinStep:   0.001,
+		},
+		Limits: LimitSettings{
+			Timezone: "UTC",
+		},
+		Liquidation: LiquidationSettings{
+			AlertDistance:  0.1,
+			ReduceDistance: 0.05,
+			ReduceFraction: 0.5,
+		},
+		Intervals: IntervalSettings{
+			Loop:          5 * time.Second,
+			MinEval:       time.Second,
+			Debounce:      200 * time.Millisecond,
+			Warmup:        5 * time.Second,
+			PositionCheck: time.Minute,
+			Markets:       time.Hour,
+		},
+		Endpoints: EndpointSettings{
+			API:    nobitex.DefaultBaseURL,
+			Stream: nobitex.DefaultStreamURL,
+		},
+		Logging: LoggingSettings{
+			Dir:   "log",
+			Level: "info",
+		},
+		State: StateSettings{
+			Path: "state/bot.db",
+		},
+		Shutdown: ShutdownSettings{
+			Timeout: 30 * time.Second,
+		},
+		Stream: StreamSettings{
+			StaleAfter:   time.Minute,
+			ReconnectMin: time.Second,
+			ReconnectMax: time.Minute,
+			TradeWindow:  time.Minute,
+		},
+		Paper: PaperSettings{
+			Balance: 100000000,
+			FeeRate: 0.0013,
+		},
+	}
+}
+
+// LoadConfig builds the configuration from defaults, the YAML file at path
+// (skipped when path is empty) and environment variables, including those in
+// .env. It does not validate; call Validate once flags are applied.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("failed to load .env: %w", err)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config: %w", err)
+		}
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set.apply(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+	return cfg, nil
+}
+
+// SetPairs replaces the configured pairs with symbols at equal weight.
+func (c *Config) SetPairs(symbols []string) {
+	c.Pairs = make([]PairSettings, len(symbols))
+	for i, s := range symbols {
+		c.Pairs[i] = PairSettings{Symbol: s}
+	}
+}
+
+// normalize fills in per-pair defaults and names quote currencies as the
+// order APIs do.
+func (c *Config) normalize() {
+	if len(c.Risk.MinBalances) > 0 {
+		balances := make(map[string]float64, len(c.Risk.MinBalances))
+		for quote, v := range c.Risk.MinBalances {
+			quote = strings.ToLower(strings.TrimSpace(quote))
+			if quote == "irt" {
+				quote = "rls"
+			}
+			balances[quote] = v
+		}
+		c.Risk.MinBalances = balances
+	}
+	for i := range c.Pairs {
+		c.Pairs[i].Symbol = strings.ToUpper(strings.TrimSpace(c.Pairs[i].Symbol))
+		if c.Pairs[i].Weight == 0 {
+			c.Pairs[i].Weight = 1
+		}
+	}
+}
+
+// pairCap is the most a pair may commit: its max_notional, or else the
+// minimum balance of its quote currency. It is zero when neither is set.
+func (c Config) pairCap(p PairSettings) float64 {
+	if p.MaxNotional > 0 {
+		return p.MaxNotional
+	}
+	return c.Risk.minBalance(p.Symbol)
+}
+
+// minBalance is the balance committed to positions per pair quoted like
+// symbol.
+func (r RiskSettings) minBalance(symbol string) float64 {
+	m, err := nobitex.ParseMarket(symbol)
+	if err != nil {
+		return 0
+	}
+	if v, ok := r.MinBalances[m.Dst]; ok {
+		return v
+	}
+	if m.Dst == "rls" {
+		return r.MinBalance
+	}
+	return 0
+}
+
+// Validate normalizes pair settings and reports every invalid setting at once.
+func (c *Config) Validate() error {
+	c.normalize()
+
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(len(c.Pairs) > 0, "pairs: at least one currency pair is required")
+	seen := make(map[string]bool)
+	quotes := make(map[string]bool)
+	for i, p := range c.Pairs {
+		check(p.Symbol != "", "pairs[%d].symbol must not be empty", i)
+		if m, err := nobitex.ParseMarket(p.Symbol); err != nil {
+			errs = append(errs, fmt.Errorf("pairs[%d].symbol: %w", i, err))
+		} else {
+			quotes[m.Dst] = true
+		}
+		check(!seen[p.Symbol], "pairs[%d]: %s is listed twice", i, p.Symbol)
+		check(p.Weight > 0, "pairs[%d].weight must be > 0 (got %v)", i, p.Weight)
+		check(p.MaxNotional >= 0, "pairs[%d].max_notional must not be negative (got %v)", i, p.MaxNotional)
+		check(p.AmountStep >= 0, "pairs[%d].amount_step must not be negative (got %v)", i, p.AmountStep)
+		if m, err := nobitex.ParseMarket(p.Symbol); err == nil && m.Dst != "rls" {
+			check(c.pairCap(p) > 0, "pairs[%d]: %s is quoted in %s; set its max_notional or risk.min_balances.%s", i, p.Symbol, m.Dst, m.Dst)
+		}
+		seen[p.Symbol] = true
+	}
+
+	check(c.Strategy.Window > 0, "strategy.window must be > 0 (got %d)", c.Strategy.Window)
+	_, err := nobitex.ResolutionDuration(c.Strategy.Resolution)
+	check(err == nil, "strategy.resolution: %v", err)
+	if _, err := NewStrategy(c.Strategy.Name, c.Strategy.strategyConfig()); err != nil {
+		errs = append(errs, fmt.Errorf("strategy: %w", err))
+	}
+
+	check(c.Risk.ProfitTarget > 0, "risk.profit_target must be > 0 (got %v)", c.Risk.ProfitTarget)
+	check(c.Risk.StopLoss > 0, "risk.stop_loss must be > 0 (got %v)", c.Risk.StopLoss)
+	check(c.Risk.Leverage >= 1 && c.Risk.Leverage <= ExchangeMaxLeverage,
+		"risk.leverage must be between 1 and the exchange max of %v (got %v)", ExchangeMaxLeverage, c.Risk.Leverage)
+	if c.Risk.Leverage >= 1 {
+		check(c.Risk.StopLoss < 1/c.Risk.Leverage,
+			"risk.stop_loss %v is past liquidation at %vx leverage", c.Risk.StopLoss, c.Risk.Leverage)
+	}
+	check(c.Risk.MinBalance > 0, "risk.min_balance must be > 0 (got %v)", c.Risk.MinBalance)
+	for quote, v := range c.Risk.MinBalances {
+		check(v > 0, "risk.min_balances.%s must be > 0 (got %v)", quote, v)
+	}
+
+	switch c.Sizing.Mode {
+	case "fixed":
+		check(c.Sizing.Notional >= 0, "sizing.notional must not be negative (got %v)", c.Sizing.Notional)
+	case "equity":
+		check(c.Sizing.EquityFraction > 0, "sizing.equity_fraction must be > 0 (got %v)", c.Sizing.EquityFraction)
+	case "risk":
+		check(c.Sizing.RiskFraction > 0 && c.Sizing.RiskFraction < 1,
+			"sizing.risk_fraction must be between 0 and 1 (got %v)", c.Sizing.RiskFraction)
+	case "volatility":
+		check(c.Sizing.VolatilityTarget > 0, "sizing.volatility_target must be > 0 (got %v)", c.Sizing.VolatilityTarget)
+		check(c.Sizing.ATRPeriod > 0, "sizing.atr_period must be > 0 (got %d)", c.Sizing.ATRPeriod)
+		check(c.Strategy.Window >= c.Sizing.ATRPeriod,
+			"sizing.atr_period %d needs strategy.window of at least as many candles (got %d)", c.Sizing.ATRPeriod, c.Strategy.Window)
+	default:
+		errs = append(errs, fmt.Errorf("sizing.mode must be fixed, equity, risk or volatility (got %q)", c.Sizing.Mode))
+	}
+	check(c.Sizing.MaxNotional >= 0, "sizing.max_notional must not be negative (got %v)", c.Sizing.MaxNotional)
+
+	total := 0.0
+	for i, t := range c.Exits.Tranches {
+		check(t.Fraction > 0, "exits.tranches[%d].fraction must be > 0 (got %v)", i, t.Fraction)
+		check(t.Profit > 0, "exits.tranches[%d].profit must be > 0 (got %v)", i, t.Profit)
+		total += t.Fraction
+	}
+	check(total <= 1+1e-9, "exits.tranches fractions must add up to at most 1 (got %v)", total)
+	check(!c.Exits.BreakEven || len(c.Exits.Tranches) > 0, "exits.break_even needs at least one tranche")
+	check(c.Exits.FeeRate >= 0, "exits.fee_rate must not be negative (got %v)", c.Exits.FeeRate)
+
+	if c.Trailing.Enabled {
+		switch c.Trailing.Mode {
+		case "percent":
+			check(c.Trailing.Distance > 0 && c.Trailing.Distance < 1,
+				"trailing.distance must be between 0 and 1 in percent mode (got %v)", c.Trailing.Distance)
+		case "atr":
+			check(c.Trailing.Distance > 0, "trailing.distance must be > 0 (got %v)", c.Trailing.Distance)
+			check(c.Trailing.ATRPeriod > 0, "trailing.atr_period must be > 0 (got %d)", c.Trailing.ATRPeriod)
+			check(c.Strategy.Window >= c.Trailing.ATRPeriod,
+				"trailing.atr_period %d needs strategy.window of at least as many candles (got %d)", c.Trailing.ATRPeriod, c.Strategy.Window)
+		default:
+			errs = append(errs, fmt.Errorf("trailing.mode must be percent or atr (got %q)", c.Trailing.Mode))
+		}
+		check(c.Trailing.MinStep >= 0, "trailing.min_step must not be negative (got %v)", c.Trailing.MinStep)
+	}
+
+	check(c.Limits.MaxDailyLoss >= 0, "limits.max_daily_loss must not be negative (got %v)", c.Limits.MaxDailyLoss)
+	check(c.Limits.MaxConsecutiveLosses >= 0, "limits.max_consecutive_losses must not be negative (got %d)", c.Limits.MaxConsecutiveLosses)
+	check(c.Limits.MaxDrawdown >= 0, "limits.max_drawdown must not be negative (got %v)", c.Limits.MaxDrawdown)
+	check(len(quotes) <= 1 || (c.Limits.MaxDailyLoss == 0 && c.Limits.MaxDrawdown == 0),
+		"limits.max_daily_loss and limits.max_drawdown add up PnL in one currency; they cannot be used with pairs quoted in different currencies")
+	_, err = time.LoadLocation(c.Limits.Timezone)
+	check(err == nil, "limits.timezone: %v", err)
+
+	liq := c.Liquidation
+	check(liq.AlertDistance >= 0 && liq.AlertDistance < 1,
+		"liquidation.alert_distance must be between 0 and 1 (got %v)", liq.AlertDistance)
+	check(liq.ReduceDistance >= 0 && liq.ReduceDistance < 1,
+		"liquidation.reduce_distance must be between 0 and 1 (got %v)", liq.ReduceDistance)
+	if liq.ReduceDistance > 0 {
+		check(liq.ReduceFraction > 0 && liq.ReduceFraction <= 1,
+			"liquidation.reduce_fraction must be in (0, 1] (got %v)", liq.ReduceFraction)
+		check(liq.AlertDistance == 0 || liq.AlertDistance >= liq.ReduceDistance,
+			"liquidation.alert_distance %v must not be inside reduce_distance %v", liq.AlertDistance, liq.ReduceDistance)
+	}
+
+	check(c.Intervals.Loop > 0, "intervals.loop must be > 0 (got %v)", c.Intervals.Loop)
+	check(c.Intervals.MinEval >= 0, "intervals.min_eval must not be negative (got %v)", c.Intervals.MinEval)
+	check(c.Intervals.Debounce >= 0, "intervals.debounce must not be negative (got %v)", c.Intervals.Debounce)
+	check(c.Intervals.Warmup >= 0, "intervals.warmup must not be negative (got %v)", c.Intervals.Warmup)
+	check(c.Intervals.PositionCheck > 0, "intervals.position_check must be > 0 (got %v)", c.Intervals.PositionCheck)
+	check(c.Intervals.Markets > 0, "intervals.markets must be > 0 (got %v)", c.Intervals.Markets)
+
+	check(strings.HasPrefix(c.Endpoints.API, "http://") || strings.HasPrefix(c.Endpoints.API, "https://"),
+		"endpoints.api must be an http(s) URL (got %q)", c.Endpoints.API)
+	check(strings.HasPrefix(c.Endpoints.Stream, "ws://") || strings.HasPrefix(c.Endpoints.Stream, "wss://"),
+		"endpoints.stream must be a ws(s) URL (got %q)", c.Endpoints.Stream)
+
+	check(c.Stream.StaleAfter > 0, "stream.stale_after must be > 0 (got %v)", c.Stream.StaleAfter)
+	check(c.Stream.ReconnectMin > 0, "stream.reconnect_min must be > 0 (got %v)", c.Stream.ReconnectMin)
+	check(c.Stream.ReconnectMax >= c.Stream.ReconnectMin,
+		"stream.reconnect_max %v must not be below reconnect_min %v", c.Stream.ReconnectMax, c.Stream.ReconnectMin)
+	check(!c.Stream.Trades || c.Stream.TradeWindow > 0, "stream.trade_window must be > 0 (got %v)", c.Stream.TradeWindow)
+
+	check(c.Logging.Dir != "", "logging.dir must not be empty")
+	check(c.State.Path != "", "state.path must not be empty")
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be > 0 (got %v)", c.Shutdown.Timeout)
+	_, err = logrus.ParseLevel(c.Logging.Level)
+	check(err == nil, "logging.level: %v", err)
+
+	if c.Paper.Enabled {
+		check(c.Paper.Balance > 0, "paper.balance must be > 0 (got %v)", c.Paper.Balance)
+		check(c.Paper.FeeRate >= 0, "paper.fee_rate must not be negative (got %v)", c.Paper.FeeRate)
+	}
+
+	return errors.Join(errs...)
+}
+
+// LeverageString formats the leverage as the margin API expects it.
+func (r RiskSettings) LeverageString() string {
+	return strconv.FormatFloat(r.Leverage, 'f', 1, 64)
+}
+
+func (s StrategySettings) strategyConfig() StrategyConfig {
+	return StrategyConfig{
+		Window:         s.Window,
+		PriceDeviation: s.PriceDeviation,
+		Params:         s.Params,
+	}
+}
+
+// setting is a configuration value that can be overridden by an environment
+// variable and a command-line flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   setter
+}
+
+// setter parses a setting's value into a Config. Bool settings may be given
+// as a bare flag.
+type setter struct {
+	apply  func(c *Config, value string) error
+	isBool bool
+}
+
+var settings = []setting{
+	{"strategy", "BOT_STRATEGY", "entry strategy name", stringSetting(func(c *Config) *string { return &c.Strategy.Name })},
+	{"window", "BOT_WINDOW", "candles fed to the strategy", intSetting(func(c *Config) *int { return &c.Strategy.Window })},
+	{"resolution", "BOT_RESOLUTION", "candle resolution", stringSetting(func(c *Config) *string { return &c.Strategy.Resolution })},
+	{"deviation", "BOT_PRICE_DEVIATION", "entry deviation from the moving average", floatSetting(func(c *Config) *float64 { return &c.Strategy.PriceDeviation })},
+	{"profit", "BOT_PROFIT_TARGET", "take-profit distance from entry", floatSetting(func(c *Config) *float64 { return &c.Risk.ProfitTarget })},
+	{"stop", "BOT_STOP_LOSS", "stop-loss distance from entry", floatSetting(func(c *Config) *float64 { return &c.Risk.StopLoss })},
+	{"leverage", "BOT_LEVERAGE", "margin leverage", floatSetting(func(c *Config) *float64 { return &c.Risk.Leverage })},
+	{"min-balance", "BOT_MIN_BALANCE", "rials committed to positions", floatSetting(func(c *Config) *float64 { return &c.Risk.MinBalance })},
+	{"sizing", "BOT_SIZING", "position sizing mode: fixed, equity, risk or volatility", stringSetting(func(c *Config) *string { return &c.Sizing.Mode })},
+	{"max-notional", "BOT_MAX_NOTIONAL", "most rials a single entry commits", floatSetting(func(c *Config) *float64 { return &c.Sizing.MaxNotional })},
+	{"break-even", "BOT_BREAK_EVEN", "move stops to break-even after the first take-profit tranche", boolSetting(func(c *Config) *bool { return &c.Exits.BreakEven })},
+	{"trailing", "BOT_TRAILING", "trail the stop-loss behind the best price", boolSetting(func(c *Config) *bool { return &c.Trailing.Enabled })},
+	{"trailing-mode", "BOT_TRAILING_MODE", "trailing distance mode: percent or atr", stringSetting(func(c *Config) *string { return &c.Trailing.Mode })},
+	{"trailing-distance", "BOT_TRAILING_DISTANCE", "trailing distance (fraction of price or ATR multiple)", floatSetting(func(c *Config) *float64 { return &c.Trailing.Distance })},
+	{"max-daily-loss", "BOT_MAX_DAILY_LOSS", "halt entries after this many rials of realized loss in a day", floatSetting(func(c *Config) *float64 { return &c.Limits.MaxDailyLoss })},
+	{"max-losses", "BOT_MAX_CONSECUTIVE_LOSSES", "halt entries after this many losing positions in a row", intSetting(func(c *Config) *int { return &c.Limits.MaxConsecutiveLosses })},
+	{"max-drawdown", "BOT_MAX_DRAWDOWN", "halt entries after giving back this many rials from the realized PnL peak", floatSetting(func(c *Config) *float64 { return &c.Limits.MaxDrawdown })},
+	{"day-timezone", "BOT_DAY_TIMEZONE", "time zone the trading day starts in", stringSetting(func(c *Config) *string { return &c.Limits.Timezone })},
+	{"liq-alert", "BOT_LIQ_ALERT_DISTANCE", "alert when a position is this close to liquidation (fraction of price)", floatSetting(func(c *Config) *float64 { return &c.Liquidation.AlertDistance })},
+	{"liq-reduce", "BOT_LIQ_REDUCE_DISTANCE", "cut a position this close to liquidation (fraction of price)", floatSetting(func(c *Config) *float64 { return &c.Liquidation.ReduceDistance })},
+	{"loop-interval", "BOT_LOOP_INTERVAL", "how often positions and the balance are refreshed", durationSetting(func(c *Config) *time.Duration { return &c.Intervals.Loop })},
+	{"eval-interval", "BOT_EVAL_INTERVAL", "least time between two strategy evaluations", durationSetting(func(c *Config) *time.Duration { return &c.Intervals.MinEval })},
+	{"api-url", "NOBITEX_API_URL", "Nobitex REST base URL", stringSetting(func(c *Config) *string { return &c.Endpoints.API })},
+	{"stream-url", "NOBITEX_STREAM_URL", "Nobitex WebSocket URL", stringSetting(func(c *Config) *string { return &c.Endpoints.Stream })},
+	{"stale-after", "BOT_STALE_AFTER", "treat the order book as stale after this long without updates", durationSetting(func(c *Config) *time.Duration { return &c.Stream.StaleAfter })},
+	{"stream-trades", "BOT_STREAM_TRADES", "subscribe to public trades for trade flow and faster fill detection", boolSetting(func(c *Config) *bool { return &c.Stream.Trades })},
+	{"stream-candles", "BOT_STREAM_CANDLES", "build candles from the candle stream instead of polling history", boolSetting(func(c *Config) *bool { return &c.Stream.Candles })},
+	{"stream-private", "BOT_STREAM_PRIVATE", "take order fills and cancellations from the private WebSocket channels instead of polling", boolSetting(func(c *Config) *bool { return &c.Stream.Private })},
+	{"log-dir", "BOT_LOG_DIR", "directory for log files", stringSetting(func(c *Config) *string { return &c.Logging.Dir })},
+	{"log-level", "BOT_LOG_LEVEL", "log level", stringSetting(func(c *Config) *string { return &c.Logging.Level })},
+	{"state-path", "BOT_STATE_PATH", "state database file", stringSetting(func(c *Config) *string { return &c.State.Path })},
+	{"flatten", "BOT_FLATTEN_ON_EXIT", "close open positions on shutdown", boolSetting(func(c *Config) *bool { return &c.Shutdown.Flatten })},
+	{"paper", "BOT_PAPER", "trade against a simulated account fed by live market data", boolSetting(func(c *Config) *bool { return &c.Paper.Enabled })},
+	{"paper-balance", "BOT_PAPER_BALANCE", "starting RLS balance of the paper account", floatSetting(func(c *Config) *float64 { return &c.Paper.Balance })},
+	{"paper-fee", "BOT_PAPER_FEE", "fee rate charged on paper fills", floatSetting(func(c *Config) *float64 { return &c.Paper.FeeRate })},
+}
+
+func stringSetting(field func(*Config) *string) setter {
+	return setter{apply: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func intSetting(field func(*Config) *int) setter {
+	return setter{apply: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			*field(c) = n
+		}
+		return err
+	}}
+}
+
+func floatSetting(field func(*Config) *float64) setter {
+	return setter{apply: func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			*field(c) = f
+		}
+		return err
+	}}
+}
+
+func boolSetting(field func(*Config) *bool) setter {
+	return setter{apply: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			*field(c) = b
+		}
+		return err
+	}, isBool: true}
+}
+
+func durationSetting(field func(*Config) *time.Duration) setter {
+	return setter{apply: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			*field(c) = d
+		}
+		return err
+	}}
+}
+
+// BindConfigFlags registers a flag for every overridable setting on fs. The
+// returned function applies the flags that were set to a loaded Config.
+func BindConfigFlags(fs *flag.FlagSet) func(*Config) {
+	var overrides []func(*Config)
+	for _, s := range settings {
+		set := func(v string) error {
+			// Parse now so bad values fail with the flag's usage message.
+			if err := s.set.apply(&Config{}, v); err != nil {
+				return err
+			}
+			overrides = append(overrides, func(c *Config) { _ = s.set.apply(c, v) })
+			return nil
+		}
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		if s.set.isBool {
+			fs.BoolFunc(s.flag, usage, set)
+		} else {
+			fs.Func(s.flag, usage, set)
+		}
+	}
+	return func(c *Config) {
+		for _, apply := range overrides {
+			apply(c)
+		}
+	}
+}
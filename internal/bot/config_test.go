@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestBindConfigFlagsBareBools(t *testing.T) {
+	fs := flag.NewFlagSet("bot", flag.ContinueOnError)
+	apply := BindConfigFlags(fs)
+	args := []string{"--stream-trades", "--stream-candles", "--stream-private", "--paper", "--window", "30"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	apply(&cfg)
+	if !cfg.Stream.Trades || !cfg.Stream.Candles || !cfg.Stream.Private || !cfg.Paper.Enabled {
+		t.Errorf("bare bool flags not applied: stream %+v, paper %v", cfg.Stream, cfg.Paper.Enabled)
+	}
+	if cfg.Strategy.Window != 30 {
+		t.Errorf("window = %d, want 30", cfg.Strategy.Window)
+	}
+
+	// Every bool setting registers as a bool flag.
+	for _, s := range settings {
+		f := fs.Lookup(s.flag)
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		if isBool := ok && b.IsBoolFlag(); isBool != s.set.isBool {
+			t.Errorf("--%s: bool flag = %v, want %v", s.flag, isBool, s.set.isBool)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// eventKind is a set of reasons to re-evaluate the strategy.
+type eventKind int
+
+const (
+	bookEvent     eventKind = 1 << iota // the best bid or ask moved
+	candleEvent                         // a candle closed
+	positionEvent                       // a position opened or closed, or an entry loop ended
+	fillEvent                           // the private stream reported a fill on the pair
+)
+
+// candleDelay is how long after a candle closes its bar is fetched, so the
+// history endpoint has it.
+const candleDelay = 2 * time.Second
+
+// eventQueue collects events until the main loop takes them. Events of the
+// same kind arriving in between are coalesced, so a burst of order book
+// updates costs one evaluation.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending eventKind
+	wake    chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{wake: make(chan struct{}, 1)}
+}
+
+// notify records an event and wakes the main loop. It never blocks.
+func (q *eventQueue) notify(kind eventKind) {
+	q.mu.Lock()
+	q.pending |= kind
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the pending events.
+func (q *eventQueue) take() eventKind {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kind := q.pending
+	q.pending = 0
+	return kind
+}
+
+// broadcast wakes every goroutine waiting on it. Waiters take the channel
+// before checking what they wait for, so a notify in between is not lost.
+type broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel closed by the next notify.
+func (b *broadcast) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+// notify wakes the current waiters. It never blocks.
+func (b *broadcast) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		close(b.ch)
+		b.ch = nil
+	}
+}
+
+// waitFor blocks until wake fires, d passes or ctx is done.
+func waitFor(ctx context.Context, wake <-chan struct{}, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-wake:
+	case <-timer.C:
+	}
+}
+
+// candleClock raises a candleEvent shortly after each candle at the strategy's
+// resolution closes, until ctx is cancelled.
+func (bot *TradingBot) candleClock(ctx context.Context) {
+	defer bot.wg.Done()
+	step, err := nobitex.ResolutionDuration(bot.cfg.Strategy.Resolution)
+	if err != nil {
+		return
+	}
+	for {
+		next := time.Now().Truncate(step).Add(step + candleDelay)
+		if !sleep(ctx, time.Until(next)) {
+			return
+		}
+		bot.events.notify(candleEvent)
+	}
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBroadcast(t *testing.T) {
+	var b broadcast
+	first, second := b.wait(), b.wait()
+	if first != second {
+		t.Fatal("waiters before a notify got different channels")
+	}
+
+	// A notify between taking the channel and waiting on it is not lost.
+	b.notify()
+	start := time.Now()
+	waitFor(context.Background(), first, time.Second)
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Fatalf("waited %v after a notify", waited)
+	}
+	select {
+	case <-second:
+	default:
+		t.Fatal("second waiter not woken")
+	}
+
+	// Later waiters wait for the next notify.
+	next := b.wait()
+	select {
+	case <-next:
+		t.Fatal("new waiter woken by an old notify")
+	default:
+	}
+	b.notify()
+	b.notify() // no waiters: must not block or panic
+	<-next
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	var b broadcast
+	start := time.Now()
+	waitFor(context.Background(), b.wait(), 30*time.Millisecond)
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Fatalf("returned after %v, before the timeout", waited)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	waitFor(ctx, b.wait(), time.Second)
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Fatalf("waited %v on a cancelled context", waited)
+	}
+}
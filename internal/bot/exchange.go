@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"context"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// Exchange is everything TradingBot needs from a venue: balance, margin orders,
+// positions, market rules, candles, the live market streams and the account's
+// order events. *nobitex.Client is the live implementation; paper-trading or
+// simulated exchanges can be plugged in for tests and dry runs. Every call
+// takes a context so a shutdown can abort it.
+type Exchange interface {
+	GetAvailableBalance(ctx context.Context, currency string) (float64, error)
+
+	PlaceMarginOrder(ctx context.Context, currencyPair, leverage, orderType string, amount, price float64) (int, error)
+	CancelOrder(ctx context.Context, orderID int) error
+	CheckOrderStatus(ctx context.Context, orderID int) (string, float64, error)
+	GetOpenMarginOrders(ctx context.Context, currencyPair string) ([]nobitex.Order, error)
+
+	GetOpenPositions(ctx context.Context, srcCurrency, dstCurrency string) ([]nobitex.Position, error)
+	GetPositionDetails(ctx context.Context, positionID int) (*nobitex.Position, error)
+	ClosePositionOCO(ctx context.Context, positionID int, amount, takeProfitPrice, stopPrice, stopLimitPrice float64) (int, error)
+	ClosePosition(ctx context.Context, positionID int, amount, price float64) (int, error)
+
+	GetMarkets(ctx context.Context) (map[string]nobitex.MarketInfo, error)
+	GetOHLCVData(ctx context.Context, symbol, resolution string, from, to int64) ([]nobitex.Candle, error)
+	SubscribeMarket(ctx context.Context, currencyPair string, handlers nobitex.StreamHandlers) error
+	SubscribePrivate(ctx context.Context, handlers nobitex.PrivateHandlers) error
+}
+
+var _ Exchange = (*nobitex.Client)(nil)
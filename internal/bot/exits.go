@@ -0,0 +1,391 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
+)
+
+// exitLeg is one OCO closing part of a position: a take-profit limit and a
+// stop-limit for the same amount. orderID is the take-profit leg's ID. A close
+// leg is instead a plain limit order closing the amount at once.
+type exitLeg struct {
+	orderID    int
+	amount     float64
+	takeProfit float64 // zero when unknown (adopted at startup)
+	stop       float64
+	runner     bool // closes whatever the tranches don't; its stop trails
+	close      bool // flattening or de-risking limit order, not an OCO
+}
+
+// positionExits are the exit orders working on one position.
+type positionExits struct {
+	side      string
+	entry     float64
+	liability float64 // liability when the legs were last checked
+	size      float64 // liability when the exits were first placed
+	best      float64 // highest bid for a long, lowest ask for a short, since entry
+	legs      []*exitLeg
+	filled    int     // tranches whose take-profit filled
+	breakEven bool    // stops already moved to break-even
+	stop      float64 // last stop moved to, at break-even or trailed; zero if none
+	nearLiq   bool    // inside the liquidation alert distance
+}
+
+// closingSide is the order type that closes a position opened on side.
+func closingSide(side string) string {
+	if side == "sell" {
+		return "buy"
+	}
+	return "sell"
+}
+
+// isStopOrder reports whether o is the stop leg of an OCO.
+func isStopOrder(o nobitex.Order) bool {
+	return strings.Contains(strings.ToLower(o.Execution), "stop")
+}
+
+// exitPlan splits liability into tranche amounts and the runner amount.
+// Tranches too small to place are left to the runner, and a runner too small
+// to place is folded into the last tranche.
+func (bot *TradingBot) exitPlan(liability, price float64) ([]float64, float64) {
+	minimum := bot.marketRules().MinOrderValue
+	amounts := make([]float64, len(bot.cfg.Exits.Tranches))
+	runner := liability
+	last := -1
+	for i, tranche := range bot.cfg.Exits.Tranches {
+		amount := bot.marketRules().RoundAmount(liability * tranche.Fraction)
+		if amount*price < minimum {
+			continue
+		}
+		amounts[i] = amount
+		runner -= amount
+		last = i
+	}
+	if runner*price < minimum && last >= 0 {
+		amounts[last] += runner
+		runner = 0
+	}
+	return amounts, runner
+}
+
+// placeExits protects a new position with one OCO per take-profit tranche and
+// a runner OCO for the rest.
+func (bot *TradingBot) placeExits(ctx context.Context, pos nobitex.Position, entry, liability, bestBid, bestAsk float64) {
+	risk := bot.cfg.Risk
+	exits := &positionExits{side: pos.Side, entry: entry, liability: liability, size: liability, best: entry}
+
+	amounts, runner := bot.exitPlan(liability, entry)
+	for i, amount := range amounts {
+		if amount == 0 {
+			continue
+		}
+		takeProfit, stop := ExitPrices(pos.Side, entry, bestBid, bestAsk, bot.cfg.Exits.Tranches[i].Profit, risk.StopLoss)
+		if leg := bot.placeExitLeg(ctx, pos.ID, amount, takeProfit, stop, i); leg != nil {
+			exits.legs = append(exits.legs, leg)
+		}
+	}
+	if runner > 0 {
+		takeProfit, stop := ExitPrices(pos.Side, entry, bestBid, bestAsk, risk.ProfitTarget, risk.StopLoss)
+		if leg := bot.placeExitLeg(ctx, pos.ID, runner, takeProfit, stop, -1); leg != nil {
+			leg.runner = true
+			exits.legs = append(exits.legs, leg)
+		}
+	}
+	if len(exits.legs) == 0 {
+		return
+	}
+
+	bot.exitMu.Lock()
+	bot.exits[pos.ID] = exits
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+}
+
+// placeExitLeg places one OCO; tranche is -1 for the runner. It returns nil
+// when the order could not be placed.
+func (bot *TradingBot) placeExitLeg(ctx context.Context, positionID int, amount, takeProfit, stop float64, tranche int) *exitLeg {
+	fields := logrus.Fields{
+		"position_id": positionID,
+		"amount":      amount,
+		"take_profit": takeProfit,
+		"stop_loss":   stop,
+		"tranche":     tranche,
+	}
+	orderID, err := bot.ClosePositionOrder(ctx, positionID, amount, takeProfit, stop)
+	if err != nil {
+		bot.closeLogger.WithFields(fields).WithError(err).Error("Failed to place OCO")
+		return nil
+	}
+	fields["order_id"] = orderID
+	bot.closeLogger.WithFields(fields).Info("OCO placed for position")
+	return &exitLeg{orderID: orderID, amount: amount, takeProfit: takeProfit, stop: stop}
+}
+
+// manageExits keeps an already protected position's exits up to date: it
+// drops legs that have filled or been cancelled, moves stops to break-even
+// after the first tranche, covers any liability left without an exit and
+// trails the runner's stop.
+func (bot *TradingBot) manageExits(ctx context.Context, pos nobitex.Position, entry, liability, bestBid, bestAsk float64) {
+	bot.exitMu.Lock()
+	exits := bot.exits[pos.ID]
+	if exits != nil && exits.entry == 0 {
+		// Restored without the exchange's view of the position.
+		exits.entry, exits.best = entry, entry
+	}
+	bot.exitMu.Unlock()
+	if exits == nil {
+		return
+	}
+
+	bot.refreshExits(ctx, pos, exits, liability)
+	if bot.cfg.Exits.BreakEven && exits.filled > 0 && !exits.breakEven {
+		bot.moveToBreakEven(ctx, pos, exits, bestBid, bestAsk)
+	}
+	bot.coverExits(ctx, pos, exits, liability, bestBid, bestAsk)
+	bot.trailStop(ctx, pos, exits, bestBid, bestAsk)
+}
+
+// refreshExits drops legs whose orders are no longer working, so coverExits
+// protects their amount again. Once the position's liability changes, which
+// is when one of them has (partly) filled, every leg is checked with the
+// exchange. Otherwise the private stream reports a leg cancelled by hand, and
+// without it every leg is polled on each pass.
+func (bot *TradingBot) refreshExits(ctx context.Context, pos nobitex.Position, exits *positionExits, liability float64) {
+	poll := liability != exits.liability || !bot.orders.isLive()
+
+	var open []*exitLeg
+	for _, leg := range exits.legs {
+		status := ""
+		if ev, ok := bot.orders.final(leg.orderID); ok {
+			status = ev.Status
+		} else if poll {
+			var err error
+			if status, _, err = bot.exchange.CheckOrderStatus(ctx, leg.orderID); err != nil {
+				status = ""
+			}
+		}
+		if status == "" || orderIsOpen(status) {
+			open = append(open, leg)
+			continue
+		}
+		fields := logrus.Fields{"position_id": pos.ID, "order_id": leg.orderID, "status": status, "runner": leg.runner}
+		if status == "Done" && !leg.runner && !leg.close {
+			exits.filled++
+			bot.closeLogger.WithFields(fields).Info("Take-profit tranche filled")
+		} else {
+			bot.closeLogger.WithFields(fields).Info("Exit order no longer working")
+		}
+	}
+
+	if len(open) == len(exits.legs) && liability == exits.liability {
+		return
+	}
+	bot.exitMu.Lock()
+	exits.legs = open
+	exits.liability = liability
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+}
+
+// moveToBreakEven moves the stop of every remaining leg to the entry price
+// plus the fee allowance, unless it is already tighter. Legs that could not be
+// moved are tried again on the next pass.
+func (bot *TradingBot) moveToBreakEven(ctx context.Context, pos nobitex.Position, exits *positionExits, bestBid, bestAsk float64) {
+	fee := bot.cfg.Exits.FeeRate
+	stop := exits.entry * (1 + fee)
+	if exits.side == "sell" {
+		stop = exits.entry * (1 - fee)
+	}
+	// A stop the market has already passed would trigger at once; try again
+	// on a later pass.
+	if (exits.side == "buy" && stop >= bestBid) || (exits.side == "sell" && stop <= bestAsk) {
+		return
+	}
+
+	moved := true
+	for _, leg := range append([]*exitLeg(nil), exits.legs...) {
+		if leg.close {
+			continue
+		}
+		if (exits.side == "buy" && leg.stop >= stop) || (exits.side == "sell" && leg.stop != 0 && leg.stop <= stop) {
+			continue
+		}
+		if err := bot.replaceExitLeg(ctx, pos, exits, leg, stop); err != nil {
+			moved = false
+			bot.closeLogger.WithError(err).WithField("position_id", pos.ID).Error("Failed to move stop to break-even")
+		}
+	}
+	if !moved {
+		return
+	}
+
+	bot.exitMu.Lock()
+	exits.breakEven = true
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+	bot.closeLogger.WithFields(logrus.Fields{"position_id": pos.ID, "stop_loss": stop}).Info("Stops moved to break-even")
+}
+
+// coverExits places a runner OCO for liability not covered by any leg, such as
+// after a failed placement or a leg cancelled by hand. Its stop is the last
+// one the exits were moved to, if that is tighter than the configured one.
+func (bot *TradingBot) coverExits(ctx context.Context, pos nobitex.Position, exits *positionExits, liability, bestBid, bestAsk float64) {
+	covered := 0.0
+	for _, leg := range exits.legs {
+		covered += leg.amount
+	}
+	gap := liability - covered
+	if gap*exits.entry < bot.marketRules().MinOrderValue {
+		return
+	}
+
+	takeProfit, stop := ExitPrices(exits.side, exits.entry, bestBid, bestAsk, bot.cfg.Risk.ProfitTarget, bot.cfg.Risk.StopLoss)
+	bot.exitMu.Lock()
+	last := exits.stop
+	bot.exitMu.Unlock()
+	switch {
+	case last == 0:
+	case exits.side == "buy":
+		stop = min(max(stop, last), bestBid)
+	case exits.side == "sell":
+		stop = max(min(stop, last), bestAsk)
+	}
+	leg := bot.placeExitLeg(ctx, pos.ID, gap, takeProfit, stop, -1)
+	if leg == nil {
+		return
+	}
+	leg.runner = true
+	bot.exitMu.Lock()
+	for _, other := range exits.legs {
+		if other.runner {
+			leg.runner = false
+		}
+	}
+	exits.legs = append(exits.legs, leg)
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+}
+
+// replaceExitLeg cancels a leg's OCO and places it again with a new stop. A
+// leg that cannot be placed again is dropped, and coverExits protects its
+// amount at the new stop.
+func (bot *TradingBot) replaceExitLeg(ctx context.Context, pos nobitex.Position, exits *positionExits, leg *exitLeg, stop float64) error {
+	takeProfit := leg.takeProfit
+	if takeProfit == 0 {
+		// Adopted at startup without its prices; assume the configured target.
+		takeProfit, _ = ExitPrices(exits.side, exits.entry, exits.entry, exits.entry, bot.cfg.Risk.ProfitTarget, bot.cfg.Risk.StopLoss)
+	}
+
+	// Cancelling one leg of an OCO cancels both.
+	if err := bot.exchange.CancelOrder(ctx, leg.orderID); err != nil {
+		return fmt.Errorf("cancel OCO %d: %w", leg.orderID, err)
+	}
+	orderID, err := bot.ClosePositionOrder(ctx, pos.ID, leg.amount, takeProfit, stop)
+
+	bot.exitMu.Lock()
+	exits.stop = stop
+	if err != nil {
+		for i, l := range exits.legs {
+			if l == leg {
+				exits.legs = append(exits.legs[:i], exits.legs[i+1:]...)
+				break
+			}
+		}
+	} else {
+		leg.orderID, leg.takeProfit, leg.stop = orderID, takeProfit, stop
+	}
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+	if err != nil {
+		return fmt.Errorf("re-place OCO: %w", err)
+	}
+	return nil
+}
+
+// dropExits forgets a closed position's exits, returning them or nil if the
+// position had none.
+func (bot *TradingBot) dropExits(positionID int) *positionExits {
+	bot.exitMu.Lock()
+	exits := bot.exits[positionID]
+	delete(bot.exits, positionID)
+	bot.exitMu.Unlock()
+	bot.forgetPosition(positionID)
+	return exits
+}
+
+// saveExits persists the exits of a position.
+func (bot *TradingBot) saveExits(positionID int) {
+	if bot.store == nil {
+		return
+	}
+	bot.exitMu.Lock()
+	exits, ok := bot.exits[positionID]
+	if !ok {
+		bot.exitMu.Unlock()
+		return
+	}
+	rec := store.PositionRecord{
+		Pair:       bot.currencyPair,
+		PositionID: positionID,
+		Side:       exits.side,
+		BreakEven:  exits.breakEven,
+		Stop:       exits.stop,
+	}
+	for _, leg := range exits.legs {
+		rec.Exits = append(rec.Exits, store.ExitRecord{
+			OrderID:    leg.orderID,
+			Amount:     leg.amount,
+			TakeProfit: leg.takeProfit,
+			StopLoss:   leg.stop,
+			Runner:     leg.runner,
+			Close:      leg.close,
+		})
+	}
+	bot.exitMu.Unlock()
+
+	if err := bot.store.SavePosition(rec); err != nil {
+		bot.closeLogger.WithError(err).WithField("position_id", positionID).Error("Error saving position state")
+	}
+}
+
+// restoreExits rebuilds a position's exits from the legs still working and
+// its stored record. The last OCO becomes the runner if none is marked.
+func (bot *TradingBot) restoreExits(pos nobitex.Position, entry, liability float64, rec store.PositionRecord, legs []*exitLeg) {
+	var last *exitLeg
+	for _, leg := range legs {
+		if leg.runner {
+			last = nil
+			break
+		}
+		if !leg.close {
+			last = leg
+		}
+	}
+	if last != nil {
+		last.runner = true
+	}
+
+	bot.exitMu.Lock()
+	bot.exits[pos.ID] = &positionExits{
+		side:      pos.Side,
+		entry:     entry,
+		liability: liability,
+		size:      liability,
+		best:      entry,
+		legs:      legs,
+		breakEven: rec.BreakEven,
+		stop:      rec.Stop,
+	}
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+}
+
+// storedLeg turns a stored exit back into a leg.
+func storedLeg(e store.ExitRecord) *exitLeg {
+	return &exitLeg{orderID: e.OrderID, amount: e.Amount, takeProfit: e.TakeProfit, stop: e.StopLoss, runner: e.Runner, close: e.Close}
+}
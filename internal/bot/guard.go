@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
+	"strconv"
+	"sync"
+	"time"
+	_ "time/tzdata" // limits.timezone must load on hosts without zoneinfo
+
+	"github.com/sirupsen/logrus"
+)
+
+// LossGuard tracks the realized PnL of every pair in the process against the
+// configured loss limits. Once a limit is hit it halts new entries: a daily
+// loss halt until the trading day ends, the others until ResetHalt clears
+// them. The halt, and which closes were counted, survive restarts.
+type LossGuard struct {
+	mu     sync.Mutex
+	limits LimitSettings
+	loc    *time.Location
+	store  *store.Store
+	rec    store.GuardRecord
+	seen   map[string]bool // pair/position closes already recorded
+	now    func() time.Time
+}
+
+// Loss limits a halt can be tripped by, as saved in GuardRecord.Limit.
+const (
+	limitDailyLoss         = "daily_loss"
+	limitConsecutiveLosses = "consecutive_losses"
+	limitDrawdown          = "drawdown"
+)
+
+// maxRecorded is how many counted closes are remembered across restarts.
+const maxRecorded = 1000
+
+// NewLossGuard loads the guard's state from st. cfg must already be validated.
+func NewLossGuard(cfg Config, st *store.Store) *LossGuard {
+	loc, err := time.LoadLocation(cfg.Limits.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid limits timezone: %v", err)
+	}
+	g := &LossGuard{limits: cfg.Limits, loc: loc, store: st, seen: make(map[string]bool), now: time.Now}
+	if st != nil {
+		rec, _, err := st.Guard()
+		if err != nil {
+			log.Fatalf("Failed to load loss guard state: %v", err)
+		}
+		g.rec = rec
+		for _, key := range rec.Recorded {
+			g.seen[key] = true
+		}
+	}
+	return g
+}
+
+// ResetHalt clears a halt saved in st, along with the consecutive-loss count
+// and the drawdown peak, so trading can resume.
+func ResetHalt(st *store.Store) (store.GuardRecord, error) {
+	rec, _, err := st.Guard()
+	if err != nil {
+		return rec, err
+	}
+	rec.Halted = false
+	rec.Limit = ""
+	rec.Reason = ""
+	rec.HaltedAt = time.Time{}
+	rec.ConsecutiveLosses = 0
+	rec.PeakPnL = rec.TotalPnL
+	return rec, st.SaveGuard(rec)
+}
+
+// Halted reports whether new entries are blocked, and why. A daily loss halt
+// lifts once the trading day has rolled over.
+func (g *LossGuard) Halted() (bool, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.rollDay(g.now()) && g.store != nil {
+		// On failure the day rolls over again after a restart.
+		_ = g.store.SaveGuard(g.rec)
+	}
+	return g.rec.Halted, g.rec.Reason
+}
+
+// rollDay starts a new trading day if now is past the record's, resetting
+// the daily PnL and lifting a daily loss halt. It reports whether it did.
+func (g *LossGuard) rollDay(now time.Time) bool {
+	day := now.In(g.loc).Format("2006-01-02")
+	if day == g.rec.Day {
+		return false
+	}
+	g.rec.Day = day
+	g.rec.DailyPnL = 0
+	if g.rec.Halted && g.rec.Limit == limitDailyLoss {
+		g.rec.Halted = false
+		g.rec.Limit = ""
+		g.rec.Reason = ""
+		g.rec.HaltedAt = time.Time{}
+	}
+	return true
+}
+
+// Record adds the realized PnL of a closed position. Each position is counted
+// once however many times it is reported. It returns the updated record and
+// whether this close tripped the halt.
+func (g *LossGuard) Record(pair string, positionID int, pnl float64) (store.GuardRecord, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%d", pair, positionID)
+	if g.seen[key] {
+		return g.rec, false, nil
+	}
+	g.seen[key] = true
+	g.rec.Recorded = append(g.rec.Recorded, key)
+	if extra := len(g.rec.Recorded) - maxRecorded; extra > 0 {
+		for _, old := range g.rec.Recorded[:extra] {
+			delete(g.seen, old)
+		}
+		g.rec.Recorded = append([]string(nil), g.rec.Recorded[extra:]...)
+	}
+
+	now := g.now()
+	g.rollDay(now)
+	g.rec.DailyPnL += pnl
+	g.rec.TotalPnL += pnl
+	g.rec.PeakPnL = max(g.rec.PeakPnL, g.rec.TotalPnL)
+	if pnl < 0 {
+		g.rec.ConsecutiveLosses++
+	} else {
+		g.rec.ConsecutiveLosses = 0
+	}
+
+	tripped := false
+	if !g.rec.Halted {
+		if limit, reason := g.breach(); limit != "" {
+			g.rec.Halted = true
+			g.rec.Limit = limit
+			g.rec.Reason = reason
+			g.rec.HaltedAt = now
+			tripped = true
+		}
+	}
+
+	var err error
+	if g.store != nil {
+		err = g.store.SaveGuard(g.rec)
+	}
+	return g.rec, tripped, err
+}
+
+// breach names and describes the first loss limit the record has hit, or
+// returns empty strings.
+func (g *LossGuard) breach() (string, string) {
+	l := g.limits
+	switch {
+	case l.MaxDailyLoss > 0 && -g.rec.DailyPnL >= l.MaxDailyLoss:
+		return limitDailyLoss, fmt.Sprintf("daily loss %.0f reached the limit of %.0f", -g.rec.DailyPnL, l.MaxDailyLoss)
+	case l.MaxConsecutiveLosses > 0 && g.rec.ConsecutiveLosses >= l.MaxConsecutiveLosses:
+		return limitConsecutiveLosses, fmt.Sprintf("%d consecutive losses reached the limit of %d", g.rec.ConsecutiveLosses, l.MaxConsecutiveLosses)
+	case l.MaxDrawdown > 0 && g.rec.PeakPnL-g.rec.TotalPnL >= l.MaxDrawdown:
+		return limitDrawdown, fmt.Sprintf("drawdown %.0f from the PnL peak reached the limit of %.0f", g.rec.PeakPnL-g.rec.TotalPnL, l.MaxDrawdown)
+	}
+	return "", ""
+}
+
+// recordClose adds a closed position's realized PnL to the loss guard. The
+// PnL comes from the exchange when it reports one, otherwise from the exit
+// price and the size the exits were placed for.
+func (bot *TradingBot) recordClose(ctx context.Context, pos nobitex.Position, exits *positionExits) {
+	fields := logrus.Fields{"position_id": pos.ID, "status": pos.Status}
+
+	pnl, ok := realizedPnL(pos, exits)
+	if !ok {
+		if exits != nil {
+			bot.closeLogger.WithFields(fields).Warn("Realized PnL unknown; not counted against loss limits")
+		}
+		return
+	}
+	rec, tripped, err := bot.guard.Record(bot.currencyPair, pos.ID, pnl)
+	if err != nil {
+		bot.closeLogger.WithFields(fields).WithError(err).Error("Error saving loss guard state")
+	}
+	fields["pnl"] = pnl
+	fields["daily_pnl"] = rec.DailyPnL
+	fields["consecutive_losses"] = rec.ConsecutiveLosses
+	fields["drawdown"] = rec.PeakPnL - rec.TotalPnL
+	bot.closeLogger.WithFields(fields).Info("Realized PnL recorded")
+	if tripped {
+		bot.checkHalt(ctx)
+	}
+}
+
+// realizedPnL reads or works out the PnL of a closed position.
+func realizedPnL(pos nobitex.Position, exits *positionExits) (float64, bool) {
+	if pos.PNL != nil {
+		if pnl, err := strconv.ParseFloat(*pos.PNL, 64); err == nil {
+			return pnl, true
+		}
+	}
+	if pos.ExitPrice == nil || exits == nil || exits.size == 0 {
+		return 0, false
+	}
+	entry, err := strconv.ParseFloat(pos.EntryPrice, 64)
+	if err != nil {
+		return 0, false
+	}
+	exit, err := strconv.ParseFloat(*pos.ExitPrice, 64)
+	if err != nil {
+		return 0, false
+	}
+	if pos.Side == "sell" {
+		return (entry - exit) * exits.size, true
+	}
+	return (exit - entry) * exits.size, true
+}
+
+// checkHalt reports whether the loss guard has halted trading. The first time
+// a bot sees the halt it logs it and, if configured, flattens its positions;
+// it logs again once a daily loss halt has lifted.
+func (bot *TradingBot) checkHalt(ctx context.Context) bool {
+	halted, reason := bot.guard.Halted()
+	bot.posMutex.Lock()
+	changed := halted != bot.halted
+	bot.halted = halted
+	bot.posMutex.Unlock()
+	if !changed {
+		return halted
+	}
+	if !halted {
+		bot.openLogger.Info("Loss limit halt lifted for the new trading day: new positions may be opened")
+		return false
+	}
+
+	for _, logger := range []*logrus.Logger{bot.openLogger, bot.closeLogger} {
+		logger.WithFields(logrus.Fields{"reason": reason, "flatten": bot.cfg.Limits.Flatten}).
+			Error("LOSS LIMIT HIT: trading halted, no new positions will be opened until the next trading day for the daily loss limit, or until restarted with -reset-halt")
+	}
+	if bot.cfg.Limits.Flatten {
+		bot.flattenPositions(ctx)
+	}
+	return true
+}
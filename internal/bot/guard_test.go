@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nobitex-sma-bot/internal/store"
+)
+
+func openGuardStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// guardAt returns a guard loaded from st whose clock reads *now.
+func guardAt(cfg Config, st *store.Store, now *time.Time) *LossGuard {
+	g := NewLossGuard(cfg, st)
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestLossGuardDailyHaltLiftsAtMidnight(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Limits.MaxDailyLoss = 100
+	cfg.Limits.Timezone = "Asia/Tehran"
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := openGuardStore(t)
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, tehran)
+	g := guardAt(cfg, st, &now)
+
+	if _, tripped, err := g.Record("BTCIRT", 1, -150); err != nil || !tripped {
+		t.Fatalf("loss past the daily limit: tripped %v, err %v", tripped, err)
+	}
+	now = now.Add(59 * time.Minute)
+	if halted, _ := g.Halted(); !halted {
+		t.Fatal("halt lifted before the day ended")
+	}
+
+	// No trade is recorded while halted; the new day alone lifts the halt.
+	now = now.Add(2 * time.Minute)
+	if halted, reason := g.Halted(); halted {
+		t.Fatalf("still halted after midnight: %s", reason)
+	}
+	rec, _, err := st.Guard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Halted || rec.Day != "2024-05-02" || rec.DailyPnL != 0 || rec.TotalPnL != -150 {
+		t.Errorf("saved record after midnight = %+v", rec)
+	}
+	if halted, _ := guardAt(cfg, st, &now).Halted(); halted {
+		t.Error("halted again after a restart")
+	}
+}
+
+func TestLossGuardOtherHaltsOutlastTheDay(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Limits.MaxConsecutiveLosses = 2
+	now := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	g := guardAt(cfg, nil, &now)
+
+	g.Record("BTCIRT", 1, -10)
+	if _, tripped, _ := g.Record("ETHIRT", 2, -10); !tripped {
+		t.Fatal("second loss in a row did not trip the halt")
+	}
+	now = now.Add(48 * time.Hour)
+	if halted, _ := g.Halted(); !halted {
+		t.Error("consecutive-loss halt lifted by a new day")
+	}
+}
+
+func TestLossGuardCountsEachCloseOnceAcrossRestarts(t *testing.T) {
+	cfg := DefaultConfig()
+	st := openGuardStore(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, _, err := guardAt(cfg, st, &now).Record("BTCIRT", 7, -50); err != nil {
+		t.Fatal(err)
+	}
+	g := guardAt(cfg, st, &now)
+	rec, _, err := g.Record("BTCIRT", 7, -50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.TotalPnL != -50 || rec.ConsecutiveLosses != 1 {
+		t.Errorf("close counted again after a restart: %+v", rec)
+	}
+	if rec, _, _ = g.Record("ETHIRT", 7, 20); rec.TotalPnL != -30 {
+		t.Errorf("same position ID on another pair not counted: %+v", rec)
+	}
+}
+
+func TestLossGuardForgetsOldestCloses(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := guardAt(DefaultConfig(), nil, &now)
+	for id := 1; id <= maxRecorded+1; id++ {
+		g.Record("BTCIRT", id, 1)
+	}
+	if len(g.rec.Recorded) != maxRecorded || g.rec.Recorded[0] != "BTCIRT/2" {
+		t.Fatalf("recorded %d closes starting at %q", len(g.rec.Recorded), g.rec.Recorded[0])
+	}
+	if g.seen["BTCIRT/1"] || !g.seen[fmt.Sprintf("BTCIRT/%d", maxRecorded+1)] {
+		t.Error("seen set does not match the recorded closes")
+	}
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// watchLiquidation compares a position's liquidation price with the worse of
+// the top of book and the exchange's mark price. Inside the alert distance it
+// logs a warning; inside the reduce distance it cuts the position. It does
+// nothing while the order book is stale.
+func (bot *TradingBot) watchLiquidation(ctx context.Context, pos nobitex.Position, liability, bestBid, bestAsk float64) {
+	if bot.bookStale() {
+		return
+	}
+	cfg := bot.cfg.Liquidation
+	liqPrice, err := strconv.ParseFloat(pos.LiquidationPrice, 64)
+	if err != nil || liqPrice <= 0 {
+		return
+	}
+	mark, _ := strconv.ParseFloat(pos.MarkPrice, 64)
+
+	var price, distance float64
+	switch pos.Side {
+	case "buy":
+		price = bestBid
+		if mark > 0 {
+			price = min(price, mark)
+		}
+		distance = (price - liqPrice) / price
+	case "sell":
+		price = max(bestAsk, mark)
+		distance = (liqPrice - price) / price
+	default:
+		return
+	}
+
+	bot.exitMu.Lock()
+	exits := bot.exits[pos.ID]
+	bot.exitMu.Unlock()
+	if exits == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		"position_id":       pos.ID,
+		"side":              pos.Side,
+		"price":             price,
+		"mark_price":        mark,
+		"liquidation_price": liqPrice,
+		"distance":          distance,
+		"margin_ratio":      pos.MarginRatio,
+	}
+	near := cfg.AlertDistance > 0 && distance <= cfg.AlertDistance
+	if near != exits.nearLiq {
+		bot.exitMu.Lock()
+		exits.nearLiq = near
+		bot.exitMu.Unlock()
+		if near {
+			for _, logger := range []*logrus.Logger{bot.openLogger, bot.closeLogger} {
+				logger.WithFields(fields).Warn("POSITION NEAR LIQUIDATION")
+			}
+		} else {
+			bot.closeLogger.WithFields(fields).Info("Position back out of the liquidation alert zone")
+		}
+	}
+
+	if cfg.ReduceDistance > 0 && distance <= cfg.ReduceDistance {
+		bot.reducePosition(ctx, pos, exits, liability, price, liqPrice, fields)
+	}
+}
+
+// reducePosition cancels a position's exits, closes reduce_fraction of it with
+// a limit order priced through the book and protects the rest with one OCO
+// whose stop sits halfway between the current price and liquidation. It waits
+// for an earlier cut to finish before cutting again.
+func (bot *TradingBot) reducePosition(ctx context.Context, pos nobitex.Position, exits *positionExits, liability, price, liqPrice float64, fields logrus.Fields) {
+	bot.exitMu.Lock()
+	legs := append([]*exitLeg(nil), exits.legs...)
+	bot.exitMu.Unlock()
+	if bot.cutWorking(ctx, pos.ID, exits, legs, fields) {
+		return
+	}
+
+	bot.exitMu.Lock()
+	legs = append(legs[:0], exits.legs...)
+	var runner *exitLeg
+	for _, leg := range legs {
+		if leg.runner {
+			runner = leg
+		}
+	}
+	bot.exitMu.Unlock()
+
+	rules := bot.marketRules()
+	amount := rules.RoundAmount(liability * bot.cfg.Liquidation.ReduceFraction)
+	if (liability-amount)*price < rules.MinOrderValue {
+		amount = liability
+	}
+
+	// Cancelling one leg of an OCO cancels both.
+	for _, leg := range legs {
+		if err := bot.exchange.CancelOrder(ctx, leg.orderID); err != nil {
+			bot.closeLogger.WithFields(fields).WithField("order_id", leg.orderID).WithError(err).
+				Error("Failed to cancel OCO before reducing position")
+			return
+		}
+	}
+	bot.exitMu.Lock()
+	exits.legs = nil
+	bot.exitMu.Unlock()
+
+	closePrice := rules.RoundPriceDown(price * (1 - flattenSlippage))
+	if pos.Side == "sell" {
+		closePrice = rules.RoundPriceUp(price * (1 + flattenSlippage))
+	}
+	orderID, err := bot.exchange.ClosePosition(ctx, pos.ID, amount, closePrice)
+	if err != nil {
+		// coverExits puts an OCO back on the next pass.
+		bot.saveExits(pos.ID)
+		bot.closeLogger.WithFields(fields).WithError(err).Error("Failed to reduce position near liquidation")
+		return
+	}
+	bot.exitMu.Lock()
+	exits.legs = []*exitLeg{{orderID: orderID, amount: amount, close: true}}
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+	fields["order_id"] = orderID
+	fields["amount"] = amount
+	fields["close_price"] = closePrice
+	bot.closeLogger.WithFields(fields).Warn("Position reduced near liquidation")
+
+	rest := liability - amount
+	if rest <= 0 {
+		return
+	}
+	takeProfit, _ := ExitPrices(pos.Side, exits.entry, price, price, bot.cfg.Risk.ProfitTarget, bot.cfg.Risk.StopLoss)
+	if runner != nil && runner.takeProfit != 0 {
+		takeProfit = runner.takeProfit
+	}
+	stop := (price + liqPrice) / 2
+	if runner != nil && runner.stop != 0 &&
+		((pos.Side == "buy" && runner.stop > stop && runner.stop < price) ||
+			(pos.Side == "sell" && runner.stop < stop && runner.stop > price)) {
+		stop = runner.stop
+	}
+	leg := bot.placeExitLeg(ctx, pos.ID, rest, takeProfit, stop, -1)
+	if leg == nil {
+		return
+	}
+	leg.runner = true
+	bot.exitMu.Lock()
+	exits.legs = append(exits.legs, leg)
+	bot.exitMu.Unlock()
+	bot.saveExits(pos.ID)
+}
+
+// cutWorking reports whether an earlier cut's close order is still working.
+// Finished ones are dropped from the exits; a cut whose status can't be
+// checked counts as working.
+func (bot *TradingBot) cutWorking(ctx context.Context, positionID int, exits *positionExits, legs []*exitLeg, fields logrus.Fields) bool {
+	working := false
+	var done []*exitLeg
+	for _, leg := range legs {
+		if !leg.close {
+			continue
+		}
+		status, _, err := bot.orderStatus(ctx, leg.orderID)
+		if err != nil || !orderFinished(status) {
+			working = true
+			continue
+		}
+		done = append(done, leg)
+		bot.closeLogger.WithFields(fields).WithFields(logrus.Fields{"order_id": leg.orderID, "status": status}).
+			Info("Earlier cut no longer working")
+	}
+	if len(done) == 0 {
+		return working
+	}
+
+	bot.exitMu.Lock()
+	var open []*exitLeg
+	for _, leg := range exits.legs {
+		if !slices.Contains(done, leg) {
+			open = append(open, leg)
+		}
+	}
+	exits.legs = open
+	bot.exitMu.Unlock()
+	bot.saveExits(positionID)
+	return working
+}
@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/markets"
+)
+
+// marketRules returns the trading rules of the bot's pair.
+func (bot *TradingBot) marketRules() markets.Rules {
+	rules := bot.markets.Rules(bot.currencyPair)
+	if bot.amountStep > 0 {
+		rules.AmountStep = bot.amountStep
+	}
+	return rules
+}
+
+// refreshMarkets refetches the market rules once the cached ones expire.
+func (bot *TradingBot) refreshMarkets(ctx context.Context) {
+	if err := bot.markets.Refresh(ctx); err != nil {
+		bot.openLogger.WithError(err).Warn("Error fetching market rules; using cached or default ones")
+	}
+}
+
+// leverage is the configured leverage capped at the market's maximum, as the
+// margin API expects it.
+func (bot *TradingBot) leverage() string {
+	risk := bot.cfg.Risk
+	if limit := bot.marketRules().MaxLeverage; limit > 0 && risk.Leverage > limit {
+		bot.openLogger.WithFields(logrus.Fields{"leverage": risk.Leverage, "max_leverage": limit}).
+			Debug("Leverage capped at the market's maximum")
+		risk.Leverage = limit
+	}
+	return risk.LeverageString()
+}
@@ -1,16 +1,34 @@
 package bot
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"nobitex-sma-bot/internal/nobitex"
 	"time"
 )
 
+// maxRetryDelay caps the backoff of order calls failing transiently.
+const maxRetryDelay = 30 * time.Second
+
+// restingCheckInterval is the longest an entry loop waits on a resting order
+// without a wake-up before checking the book again.
+const restingCheckInterval = time.Second
+
+// retryDelay is how long to wait after the nth failed order call: base, or for
+// transient failures such as throttling, base doubled per failure up to
+// maxRetryDelay.
+func retryDelay(err error, base time.Duration, n int) time.Duration {
+	if !nobitex.IsTransient(err) || n <= 1 {
+		return base
+	}
+	return min(base<<min(n-1, 6), maxRetryDelay)
+}
+
 // ----------------------------------------------------------------------------
 // Order Management (Place Buy/Sell in increments)
 // ----------------------------------------------------------------------------
 
-func (bot *TradingBot) PlaceBuyOrder(balance float64, maxPrice float64) {
+func (bot *TradingBot) PlaceBuyOrder(ctx context.Context, balance float64, maxPrice float64) {
 	var (
 		prevOrderID    int
 		prevOrderPrice float64
@@ -24,15 +42,27 @@ func (bot *TradingBot) PlaceBuyOrder(balance float64, maxPrice float64) {
 		"balance":   balance,
 		"max_price": maxPrice,
 	}).Info("Starting buy orders")
+	defer bot.fills.clear("buy")
 
 	for {
+		wake := bot.entryWake.wait()
+		if halted, _ := bot.guard.Halted(); ctx.Err() != nil || halted {
+			bot.cancelEntryOnStop(prevOrderID, "buy")
+			return
+		}
+		if bot.bookStale() {
+			bot.openLogger.Debug("Order book is stale. Waiting before repricing...")
+			sleep(ctx, time.Second)
+			continue
+		}
+
 		bot.bookMutex.Lock()
 		bids := bot.orderBookGlobal.Bids
 		bot.bookMutex.Unlock()
 
 		if len(bids) == 0 {
 			bot.openLogger.Warn("No bid price available. Waiting...")
-			time.Sleep(time.Second)
+			sleep(ctx, time.Second)
 			continue
 		}
 		if cancelRetries >= 40 {
@@ -46,7 +76,15 @@ func (bot *TradingBot) PlaceBuyOrder(balance float64, maxPrice float64) {
 				"current_price": currentPrice,
 				"max_price":     maxPrice,
 			}).Warn("Best buy price exceeds maximum limit, stopping.")
-			_ = nobitex.CancelOrder(bot.apiToken, prevOrderID)
+			if prevOrderID != 0 {
+				if err := bot.exchange.CancelOrder(ctx, prevOrderID); err != nil {
+					bot.openLogger.WithField("order_id", prevOrderID).
+						WithError(err).Error("Failed to cancel buy order")
+					bot.abandonEntry(ctx, prevOrderID, "buy")
+				} else {
+					bot.forgetEntryOrder(prevOrderID)
+				}
+			}
 			break
 		}
 
@@ -56,53 +94,93 @@ func (bot *TradingBot) PlaceBuyOrder(balance float64, maxPrice float64) {
 				nextBestBid := bids[1][0]
 				// If our placed price is below next best or below current best
 				if prevOrderPrice < nextBestBid*1.001 || prevOrderPrice < bids[0][0] {
-					status, matched, err := nobitex.CheckOrderStatus(bot.apiToken, prevOrderID)
+					status, matched, err := bot.orderStatus(ctx, prevOrderID)
 					if err != nil {
 						bot.openLogger.WithFields(logrus.Fields{
 							"order_id": prevOrderID,
 						}).WithError(err).Error("Error checking buy order status")
+						if nobitex.IsPermanent(err) {
+							bot.cancelEntryOnStop(prevOrderID, "buy")
+							return
+						}
 						cancelRetries++
-						time.Sleep(2 * time.Second)
+						sleep(ctx, retryDelay(err, 2*time.Second, cancelRetries))
 						continue
 					}
 					if status == "Done" {
 						bot.openLogger.WithField("order_id", prevOrderID).Info("Buy order fully matched. Exiting...")
+						bot.forgetEntryOrder(prevOrderID)
 						break
 					}
 					totalRemaining -= matched * prevPrice
 
-					if err := nobitex.CancelOrder(bot.apiToken, prevOrderID); err != nil {
+					if status == "Canceled" {
+						bot.openLogger.WithField("order_id", prevOrderID).Warn("Buy order was canceled by the exchange")
+					} else if err := bot.exchange.CancelOrder(ctx, prevOrderID); err != nil {
 						bot.openLogger.WithField("order_id", prevOrderID).
 							WithError(err).Error("Failed to cancel buy order")
+						if nobitex.IsPermanent(err) {
+							bot.abandonEntry(ctx, prevOrderID, "buy")
+							return
+						}
 						cancelRetries++
-						time.Sleep(2 * time.Second)
+						sleep(ctx, retryDelay(err, 2*time.Second, cancelRetries))
 						continue
+					} else {
+						bot.openLogger.WithField("order_id", prevOrderID).Info("Previous buy order canceled")
 					}
-					bot.openLogger.WithField("order_id", prevOrderID).Info("Previous buy order canceled")
+					bot.fills.clear("buy")
+					bot.forgetEntryOrder(prevOrderID)
 					prevOrderID = 0
 				} else {
-					continue
+					status, matched := bot.restingStatus(ctx, prevOrderID, "buy")
+					if status == "Done" {
+						bot.openLogger.WithField("order_id", prevOrderID).Info("Buy order fully matched. Exiting...")
+						bot.forgetEntryOrder(prevOrderID)
+						break
+					}
+					if status != "Canceled" {
+						waitFor(ctx, wake, restingCheckInterval)
+						continue
+					}
+					bot.openLogger.WithField("order_id", prevOrderID).Warn("Buy order was canceled by the exchange")
+					totalRemaining -= matched * prevPrice
+					bot.fills.clear("buy")
+					bot.forgetEntryOrder(prevOrderID)
+					prevOrderID = 0
 				}
 			}
 		}
 
-		if totalRemaining <= 100000 {
+		if totalRemaining <= bot.marketRules().MinOrderValue {
 			bot.openLogger.WithField("remaining_amount", totalRemaining/currentPrice).
 				Info("Remaining funds too low. Stopping buy loop.")
 			break
 		}
 
-		newPrice := bids[1][0] * 1.00001
-		amount := totalRemaining / currentPrice
-		orderID, err := nobitex.PlaceMarginOrder(bot.apiToken, bot.currencyPair, Leverage, "buy", amount, newPrice)
+		rules := bot.marketRules()
+		newPrice := rules.RoundPriceDown(bids[1][0] * 1.00001)
+		amount := rules.RoundAmount(totalRemaining / currentPrice)
+		if !rules.Placeable(amount, newPrice) {
+			bot.openLogger.WithFields(logrus.Fields{
+				"amount": amount,
+				"price":  newPrice,
+			}).Info("Remaining amount below the market minimum once rounded. Stopping buy loop.")
+			break
+		}
+		orderID, err := bot.exchange.PlaceMarginOrder(ctx, bot.currencyPair, bot.leverage(), "buy", amount, newPrice)
 		if err != nil {
 			bot.openLogger.WithError(err).WithFields(logrus.Fields{
 				"retry":  cancelRetries,
 				"amount": amount,
 				"price":  newPrice,
 			}).Error("Error placing buy order")
+			if nobitex.IsPermanent(err) {
+				bot.openLogger.WithError(err).Error("Order rejected permanently. Stopping buy loop.")
+				return
+			}
 			cancelRetries++
-			time.Sleep(1 * time.Second)
+			sleep(ctx, retryDelay(err, time.Second, cancelRetries))
 			continue
 		}
 
@@ -115,12 +193,14 @@ func (bot *TradingBot) PlaceBuyOrder(balance float64, maxPrice float64) {
 			"price":    newPrice,
 			"amount":   amount,
 		}).Info("Buy order placed")
+		bot.rememberEntryOrder(orderID, "buy", amount, newPrice)
+		bot.fills.watch("buy", newPrice)
 
-		time.Sleep(5 * time.Second)
+		sleep(ctx, 5*time.Second)
 	}
 }
 
-func (bot *TradingBot) PlaceSellOrder(balance float64, minPrice float64) {
+func (bot *TradingBot) PlaceSellOrder(ctx context.Context, balance float64, minPrice float64) {
 	var (
 		prevOrderID    int
 		prevOrderPrice float64
@@ -134,15 +214,27 @@ func (bot *TradingBot) PlaceSellOrder(balance float64, minPrice float64) {
 		"balance":   balance,
 		"min_price": minPrice,
 	}).Info("Starting sell orders")
+	defer bot.fills.clear("sell")
 
 	for {
+		wake := bot.entryWake.wait()
+		if halted, _ := bot.guard.Halted(); ctx.Err() != nil || halted {
+			bot.cancelEntryOnStop(prevOrderID, "sell")
+			return
+		}
+		if bot.bookStale() {
+			bot.openLogger.Debug("Order book is stale. Waiting before repricing...")
+			sleep(ctx, time.Second)
+			continue
+		}
+
 		bot.bookMutex.Lock()
 		asks := bot.orderBookGlobal.Asks
 		bot.bookMutex.Unlock()
 
 		if len(asks) == 0 {
 			bot.openLogger.Warn("No ask price available. Waiting...")
-			time.Sleep(time.Second)
+			sleep(ctx, time.Second)
 			continue
 		}
 		if cancelRetries >= 40 {
@@ -156,64 +248,112 @@ func (bot *TradingBot) PlaceSellOrder(balance float64, minPrice float64) {
 				"current_price": currentPrice,
 				"min_price":     minPrice,
 			}).Warn("Best sell price is below the minimum limit, stopping.")
-			_ = nobitex.CancelOrder(bot.apiToken, prevOrderID)
+			if prevOrderID != 0 {
+				if err := bot.exchange.CancelOrder(ctx, prevOrderID); err != nil {
+					bot.openLogger.WithField("order_id", prevOrderID).
+						WithError(err).Error("Failed to cancel sell order")
+					bot.abandonEntry(ctx, prevOrderID, "sell")
+				} else {
+					bot.forgetEntryOrder(prevOrderID)
+				}
+			}
 			break
 		}
 
 		if prevOrderID != 0 && len(asks) > 1 {
 			nextBestAsk := asks[1][0]
 			if prevOrderPrice > nextBestAsk*0.999 || prevOrderPrice > asks[0][0] {
-				status, matched, err := nobitex.CheckOrderStatus(bot.apiToken, prevOrderID)
+				status, matched, err := bot.orderStatus(ctx, prevOrderID)
 				if err != nil {
 					bot.openLogger.WithFields(logrus.Fields{
 						"order_id": prevOrderID,
 					}).WithError(err).Error("Error checking sell order status")
+					if nobitex.IsPermanent(err) {
+						bot.cancelEntryOnStop(prevOrderID, "sell")
+						return
+					}
 					cancelRetries++
-					time.Sleep(2 * time.Second)
+					sleep(ctx, retryDelay(err, 2*time.Second, cancelRetries))
 					continue
 				}
 				if status == "Done" {
 					bot.openLogger.WithField("order_id", prevOrderID).Info("Sell order fully matched. Exiting...")
+					bot.forgetEntryOrder(prevOrderID)
 					break
 				}
 				totalRemaining -= matched * prevPrice
-				if totalRemaining <= 100000 {
+				if totalRemaining <= bot.marketRules().MinOrderValue {
 					bot.openLogger.WithField("remaining_amount", totalRemaining).
 						Info("Remaining funds too low. Stopping sell loop.")
 					break
 				}
 
-				if err := nobitex.CancelOrder(bot.apiToken, prevOrderID); err != nil {
+				if status == "Canceled" {
+					bot.openLogger.WithField("order_id", prevOrderID).Warn("Sell order was canceled by the exchange")
+				} else if err := bot.exchange.CancelOrder(ctx, prevOrderID); err != nil {
 					bot.openLogger.WithField("order_id", prevOrderID).
 						WithError(err).Error("Failed to cancel sell order")
+					if nobitex.IsPermanent(err) {
+						bot.abandonEntry(ctx, prevOrderID, "sell")
+						return
+					}
 					cancelRetries++
-					time.Sleep(2 * time.Second)
+					sleep(ctx, retryDelay(err, 2*time.Second, cancelRetries))
 					continue
+				} else {
+					bot.openLogger.WithField("order_id", prevOrderID).Info("Previous sell order canceled")
 				}
-				bot.openLogger.WithField("order_id", prevOrderID).Info("Previous sell order canceled")
+				bot.fills.clear("sell")
+				bot.forgetEntryOrder(prevOrderID)
 				prevOrderID = 0
 			} else {
-				continue
+				status, matched := bot.restingStatus(ctx, prevOrderID, "sell")
+				if status == "Done" {
+					bot.openLogger.WithField("order_id", prevOrderID).Info("Sell order fully matched. Exiting...")
+					bot.forgetEntryOrder(prevOrderID)
+					break
+				}
+				if status != "Canceled" {
+					waitFor(ctx, wake, restingCheckInterval)
+					continue
+				}
+				bot.openLogger.WithField("order_id", prevOrderID).Warn("Sell order was canceled by the exchange")
+				totalRemaining -= matched * prevPrice
+				bot.fills.clear("sell")
+				bot.forgetEntryOrder(prevOrderID)
+				prevOrderID = 0
 			}
 		}
 
-		if totalRemaining <= 100000 {
+		if totalRemaining <= bot.marketRules().MinOrderValue {
 			bot.openLogger.WithField("remaining_amount", totalRemaining).
 				Info("Remaining funds too low. Stopping sell loop.")
 			break
 		}
 
-		newPrice := asks[1][0] * 0.99999
-		amount := totalRemaining / currentPrice
-		orderID, err := nobitex.PlaceMarginOrder(bot.apiToken, bot.currencyPair, Leverage, "sell", amount, newPrice)
+		rules := bot.marketRules()
+		newPrice := rules.RoundPriceUp(asks[1][0] * 0.99999)
+		amount := rules.RoundAmount(totalRemaining / currentPrice)
+		if !rules.Placeable(amount, newPrice) {
+			bot.openLogger.WithFields(logrus.Fields{
+				"amount": amount,
+				"price":  newPrice,
+			}).Info("Remaining amount below the market minimum once rounded. Stopping sell loop.")
+			break
+		}
+		orderID, err := bot.exchange.PlaceMarginOrder(ctx, bot.currencyPair, bot.leverage(), "sell", amount, newPrice)
 		if err != nil {
 			bot.openLogger.WithError(err).WithFields(logrus.Fields{
 				"retry":  cancelRetries,
 				"amount": amount,
 				"price":  newPrice,
 			}).Error("Error placing sell order")
+			if nobitex.IsPermanent(err) {
+				bot.openLogger.WithError(err).Error("Order rejected permanently. Stopping sell loop.")
+				return
+			}
 			cancelRetries++
-			time.Sleep(1 * time.Second)
+			sleep(ctx, retryDelay(err, time.Second, cancelRetries))
 			continue
 		}
 
@@ -226,7 +366,78 @@ func (bot *TradingBot) PlaceSellOrder(balance float64, minPrice float64) {
 			"price":    newPrice,
 			"amount":   amount,
 		}).Info("Sell order placed")
+		bot.rememberEntryOrder(orderID, "sell", amount, newPrice)
+		bot.fills.watch("sell", newPrice)
 
-		time.Sleep(5 * time.Second)
+		sleep(ctx, 5*time.Second)
+	}
+}
+
+// orderStatus returns an order's status and matched amount, from the private
+// stream when it already reported the order finished and from the API
+// otherwise.
+func (bot *TradingBot) orderStatus(ctx context.Context, orderID int) (string, float64, error) {
+	if ev, ok := bot.orders.final(orderID); ok {
+		return ev.Status, ev.Matched, nil
+	}
+	return bot.exchange.CheckOrderStatus(ctx, orderID)
+}
+
+// restingStatus returns the status and matched amount of an entry order
+// still at the top of the book if it is known to have finished: pushed by the
+// private stream, or checked once a public trade printed through its price.
+// It returns an empty status otherwise.
+func (bot *TradingBot) restingStatus(ctx context.Context, orderID int, side string) (string, float64) {
+	if ev, ok := bot.orders.final(orderID); ok {
+		return ev.Status, ev.Matched
+	}
+	if !bot.fills.take(side) {
+		return "", 0
+	}
+	status, matched, err := bot.exchange.CheckOrderStatus(ctx, orderID)
+	if err != nil {
+		bot.openLogger.WithField("order_id", orderID).WithError(err).Debug("Error checking order status after a trade at its price")
+		return "", 0
+	}
+	if !orderFinished(status) {
+		return "", 0
+	}
+	return status, matched
+}
+
+// cancelEntryOnStop cancels the entry order an order loop left resting when
+// the bot was asked to stop or trading was halted. It uses its own deadline
+// since ctx may be cancelled.
+func (bot *TradingBot) cancelEntryOnStop(orderID int, side string) {
+	if orderID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bot.cfg.Shutdown.Timeout)
+	defer cancel()
+
+	fields := logrus.Fields{"order_id": orderID, "side": side}
+	if err := bot.exchange.CancelOrder(ctx, orderID); err != nil {
+		bot.openLogger.WithFields(fields).WithError(err).Error("Failed to cancel entry order on stop")
+		return
+	}
+	bot.forgetEntryOrder(orderID)
+	bot.openLogger.WithFields(fields).Info("Entry order canceled on stop")
+}
+
+// abandonEntry is called when an order loop gives up on an entry order it
+// could not cancel. A finished order is forgotten; one still working stays
+// recorded, so reconciliation cancels it at the next start.
+func (bot *TradingBot) abandonEntry(ctx context.Context, orderID int, side string) {
+	fields := logrus.Fields{"order_id": orderID, "side": side}
+	status, _, err := bot.orderStatus(ctx, orderID)
+	if err == nil && orderFinished(status) {
+		bot.forgetEntryOrder(orderID)
+		bot.openLogger.WithFields(fields).WithField("status", status).Info("Entry order already finished")
+		if status == "Done" {
+			bot.events.notify(fillEvent)
+		}
+		return
 	}
+	bot.openLogger.WithFields(fields).WithError(err).
+		Error("Entry order could not be cancelled and is left on the book; it is cancelled at the next start")
 }
@@ -1,32 +1,43 @@
 package bot
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"io"
-	"net/http"
 	"nobitex-sma-bot/internal/nobitex"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 )
 
-// MonitorPositionsAndClose fetches open positions, logs them, and places OCO orders if needed.
-func (bot *TradingBot) MonitorPositionsAndClose() {
-	positions, err := nobitex.GetOpenPositions(bot.apiToken, strings.ToLower(strings.TrimSuffix(bot.currencyPair, "IRT")))
+// MonitorPositionsAndClose fetches open positions, logs them, places exit
+// orders on new ones and manages the exits of the rest.
+func (bot *TradingBot) MonitorPositionsAndClose(ctx context.Context) {
+	positions, err := bot.openPositions(ctx)
 	if err != nil {
 		bot.closeLogger.WithError(err).Error("Error fetching positions")
 		return
 	}
+	bot.posMutex.Lock()
+	changed := bot.positionCount != len(positions)
 	bot.positionCount = len(positions)
-	bot.closeLogger.WithField("count", bot.positionCount).Info("Open positions fetched")
+	bot.posMutex.Unlock()
+	bot.closeLogger.WithField("count", len(positions)).Info("Open positions fetched")
+	if changed {
+		bot.events.notify(positionEvent)
+	}
 
-	// Reset local counter for balance in positions
+	// Recount the balance held in positions and share it with the allocator
+	exposure := 0.0
+	for _, pos := range positions {
+		if totalAsset, err := strconv.ParseFloat(pos.TotalAsset, 64); err == nil {
+			exposure += totalAsset
+		}
+	}
 	bot.posMutex.Lock()
-	bot.balanceInPositions = 0.0
+	bot.balanceInPositions = exposure
 	bot.posMutex.Unlock()
+	bot.allocator.SetExposure(bot.currencyPair, exposure)
 
 	for _, pos := range positions {
 		positionID := pos.ID
@@ -40,16 +51,9 @@ func (bot *TradingBot) MonitorPositionsAndClose() {
 			}).Error("Error parsing entry price")
 			continue
 		}
-		totalAsset, err := strconv.ParseFloat(pos.TotalAsset, 64)
-		if err == nil {
-			bot.posMutex.Lock()
-			bot.balanceInPositions += totalAsset
-			bot.posMutex.Unlock()
-		}
-
-		bot.ocoMu.Lock()
-		ocoExists := bot.ocoOrders[positionID]
-		bot.ocoMu.Unlock()
+		bot.exitMu.Lock()
+		_, protected := bot.exits[positionID]
+		bot.exitMu.Unlock()
 
 		bot.priceMu.RLock()
 		bestBid := bot.bidBest
@@ -60,161 +64,156 @@ func (bot *TradingBot) MonitorPositionsAndClose() {
 			continue
 		}
 
-		// If no OCO order placed yet for this position
-		if !ocoExists {
-			var takeProfitPrice, stopLossPrice float64
-			switch pos.Side {
-			case "buy":
-				takeProfitPrice = max(entryPrice*(1+ProfitTarget), bestBid)
-				stopLossPrice = min(entryPrice*(1-StopLoss), bestBid)
-			case "sell":
-				takeProfitPrice = min(entryPrice*(1-ProfitTarget), bestAsk)
-				stopLossPrice = max(entryPrice*(1+StopLoss), bestAsk)
-			}
+		liability, err := strconv.ParseFloat(pos.Liability, 64)
+		if err != nil {
+			bot.closeLogger.WithError(err).WithField("position_id", positionID).
+				Error("Error parsing liability for OCO")
+			continue
+		}
 
-			liability, err := strconv.ParseFloat(pos.Liability, 64)
-			if err != nil {
-				bot.closeLogger.WithError(err).WithField("position_id", positionID).
-					Error("Error parsing liability for OCO")
-				continue
-			}
+		switch {
+		case bot.bookStale():
+			bot.closeLogger.WithField("position_id", positionID).Debug("Order book is stale; exits wait for a fresh one")
+		case !protected:
+			bot.placeExits(ctx, pos, entryPrice, liability, bestBid, bestAsk)
+		default:
+			bot.manageExits(ctx, pos, entryPrice, liability, bestBid, bestAsk)
+		}
+		bot.watchLiquidation(ctx, pos, liability, bestBid, bestAsk)
+
+		// Without the private stream, schedule a check to see if the
+		// position got closed
+		if !bot.orders.isLive() {
+			bot.wg.Add(1)
+			go func(pos nobitex.Position) {
+				defer bot.wg.Done()
+				if sleep(ctx, bot.cfg.Intervals.PositionCheck) {
+					bot.checkPositionClosed(ctx, pos.ID)
+				}
+			}(pos)
+		}
+	}
 
-			orderID, err := bot.ClosePositionOrder(positionID, liability, takeProfitPrice, stopLossPrice)
-			if err != nil {
-				bot.closeLogger.WithFields(logrus.Fields{
-					"position_id": positionID,
-					"error":       err.Error(),
-				}).Error("Failed to place OCO")
-				continue
+	// The private stream reports exit fills as they happen; a known
+	// position gone from the list means it closed without one, or one was
+	// missed. Without the stream the delayed checks above find it.
+	missing := bot.missingPositions(positions)
+	if bot.orders.isLive() {
+		for _, positionID := range missing {
+			if !bot.checkPositionClosed(ctx, positionID) {
+				bot.posMutex.Lock()
+				bot.knownPositions[positionID] = true
+				bot.posMutex.Unlock()
 			}
+		}
+	}
+}
 
-			bot.ocoMu.Lock()
-			bot.ocoOrders[positionID] = true
-			bot.ocoMu.Unlock()
+// missingPositions returns the positions open in the last list, or tracked
+// with exits, that are not among open, and remembers open as the positions
+// now known.
+func (bot *TradingBot) missingPositions(open []nobitex.Position) []int {
+	ids := make(map[int]bool, len(open))
+	for _, pos := range open {
+		ids[pos.ID] = true
+	}
 
-			bot.closeLogger.WithFields(logrus.Fields{
-				"position_id": positionID,
-				"order_id":    orderID,
-				"take_profit": takeProfitPrice,
-				"stop_loss":   stopLossPrice,
-			}).Info("OCO placed for position")
+	bot.posMutex.Lock()
+	known := bot.knownPositions
+	bot.knownPositions = ids
+	bot.posMutex.Unlock()
+	if known == nil {
+		known = make(map[int]bool)
+	}
+
+	bot.exitMu.Lock()
+	for positionID := range bot.exits {
+		known[positionID] = true
+	}
+	bot.exitMu.Unlock()
+
+	var missing []int
+	for positionID := range known {
+		if !ids[positionID] {
+			missing = append(missing, positionID)
 		}
+	}
+	sort.Ints(missing)
+	return missing
+}
 
-		// Schedule a check to see if the position got closed
-		go func(pos nobitex.Position) {
-			time.Sleep(time.Minute)
-			closed, err := bot.IsPositionClosed(pos.ID)
-			if err != nil {
-				bot.closeLogger.WithFields(logrus.Fields{
-					"position_id": pos.ID,
-					"error":       err.Error(),
-				}).Error("Error checking position status")
-				return
-			}
-			if closed {
-				bot.ocoMu.Lock()
-				delete(bot.ocoOrders, pos.ID)
-				bot.ocoMu.Unlock()
-				bot.closeLogger.WithField("position_id", pos.ID).Info("Position closed. Removed from OCO.")
-			}
-		}(pos)
+// checkPositionClosed fetches a position and, if it has been closed, drops its
+// exits and records its PnL. It returns false if the position could not be
+// fetched.
+func (bot *TradingBot) checkPositionClosed(ctx context.Context, positionID int) bool {
+	details, err := bot.exchange.GetPositionDetails(ctx, positionID)
+	if err != nil {
+		bot.closeLogger.WithFields(logrus.Fields{
+			"position_id": positionID,
+			"error":       err.Error(),
+		}).Error("Error checking position status")
+		return false
 	}
+	if positionClosed(details.Status) {
+		exits := bot.dropExits(positionID)
+		bot.closeLogger.WithFields(logrus.Fields{"position_id": positionID, "status": details.Status}).
+			Info("Position closed. Removed from OCO.")
+		bot.recordClose(ctx, *details, exits)
+		bot.events.notify(positionEvent)
+	}
+	return true
 }
 
-// ClosePositionOrder places an OCO order to close a position, with retries.
+// stopLimitSlippage is how far past its trigger the stop-limit leg of an OCO
+// is priced.
+const stopLimitSlippage = 0.1
+
+// ClosePositionOrder places an OCO order to close a position, retrying until
+// the exchange rejects it permanently.
+// Prices are rounded to the market's tick; the stop-limit is priced
+// stopLimitSlippage past the stop so it fills once triggered.
 func (bot *TradingBot) ClosePositionOrder(
+	ctx context.Context,
 	positionID int,
 	amount, takeProfitPrice, stopLossPrice float64,
 ) (int, error) {
-	url := fmt.Sprintf("https://api.nobitex.ir/positions/%d/close", positionID)
-	adjustment := 0.9
+	const maxRetries = 15
+	rules := bot.marketRules()
+	takeProfitPrice = rules.RoundPrice(takeProfitPrice)
+	stopLossPrice = rules.RoundPrice(stopLossPrice)
+	// A take-profit below the stop closes a short.
+	stopLimitPrice := rules.RoundPriceDown(stopLossPrice * (1 - stopLimitSlippage))
 	if takeProfitPrice < stopLossPrice {
-		adjustment = 1.1
-	}
-	payload := map[string]interface{}{
-		"amount":         strconv.FormatFloat(amount, 'f', -1, 64),
-		"price":          strconv.FormatFloat(takeProfitPrice, 'f', -1, 64),
-		"mode":           "oco",
-		"stopPrice":      strconv.FormatFloat(stopLossPrice, 'f', -1, 64),
-		"stopLimitPrice": strconv.FormatFloat(stopLossPrice*adjustment, 'f', -1, 64),
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		bot.closeLogger.WithError(err).
-			WithField("position_id", positionID).
-			Error("Error marshaling OCO payload")
-		return 0, err
+		stopLimitPrice = rules.RoundPriceUp(stopLossPrice * (1 + stopLimitSlippage))
 	}
-
-	const (
-		maxRetries = 15
-		retryDelay = 2 * time.Second
-	)
-	var orderID int
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+		orderID, err := bot.exchange.ClosePositionOCO(ctx, positionID, amount, takeProfitPrice, stopLossPrice, stopLimitPrice)
 		if err != nil {
 			bot.closeLogger.WithFields(logrus.Fields{"position_id": positionID, "attempt": attempt}).
-				WithError(err).Error("Error creating request to close position")
-		} else {
-			req.Header.Set("Authorization", "Token "+bot.apiToken)
-			req.Header.Set("Content-Type", "application/json")
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				bot.closeLogger.WithFields(logrus.Fields{"position_id": positionID, "attempt": attempt}).
-					WithError(err).Error("Error sending HTTP request for ClosePositionOrder")
-			} else {
-				defer resp.Body.Close()
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					bot.closeLogger.WithFields(logrus.Fields{"position_id": positionID, "attempt": attempt}).
-						WithError(err).Error("Error reading response for ClosePositionOrder")
-				} else {
-					var r struct {
-						Status string `json:"status"`
-						Order  struct {
-							ID int `json:"id"`
-						} `json:"order"`
-						Orders []struct {
-							ID int `json:"id"`
-						} `json:"orders"`
-					}
-					if err := json.Unmarshal(body, &r); err != nil {
-						bot.closeLogger.WithFields(logrus.Fields{"position_id": positionID, "attempt": attempt}).
-							WithError(err).Error("Error unmarshaling response for ClosePositionOrder")
-					} else if r.Status != "ok" {
-						bot.closeLogger.WithFields(logrus.Fields{
-							"position_id": positionID,
-							"attempt":     attempt,
-							"response":    string(body),
-						}).Error("Close position OCO order failed (status != ok)")
-					} else {
-						if len(r.Orders) > 0 {
-							orderID = r.Orders[0].ID
-						} else {
-							orderID = r.Order.ID
-						}
-						bot.closeLogger.WithFields(logrus.Fields{
-							"position_id": positionID,
-							"order_id":    orderID,
-							"take_profit": takeProfitPrice,
-							"stop_loss":   stopLossPrice,
-							"attempt":     attempt,
-						}).Info("OCO order placed successfully")
-						return orderID, nil
-					}
-				}
+				WithError(err).Error("Close position OCO order failed")
+			if nobitex.IsPermanent(err) {
+				return 0, err
 			}
+		} else {
+			bot.closeLogger.WithFields(logrus.Fields{
+				"position_id": positionID,
+				"order_id":    orderID,
+				"take_profit": takeProfitPrice,
+				"stop_loss":   stopLossPrice,
+				"attempt":     attempt,
+			}).Info("OCO order placed successfully")
+			return orderID, nil
 		}
 
 		if attempt < maxRetries {
+			delay := retryDelay(err, 2*time.Second, attempt)
 			bot.closeLogger.WithFields(logrus.Fields{
 				"position_id": positionID,
 				"attempt":     attempt,
-			}).Warnf("Retrying OCO order in %v...", retryDelay)
-			time.Sleep(retryDelay)
+			}).Warnf("Retrying OCO order in %v...", delay)
+			if !sleep(ctx, delay) {
+				return 0, ctx.Err()
+			}
 		} else {
 			bot.closeLogger.WithFields(logrus.Fields{
 				"position_id": positionID,
@@ -224,11 +223,15 @@ func (bot *TradingBot) ClosePositionOrder(
 	return 0, fmt.Errorf("failed to place OCO order after %d attempts", maxRetries)
 }
 
-// IsPositionClosed returns whether a position has status "Closed".
-func (bot *TradingBot) IsPositionClosed(positionID int) (bool, error) {
-	pos, err := nobitex.GetPositionDetails(bot.apiToken, positionID)
+// IsPositionClosed returns whether a position has been closed or liquidated.
+func (bot *TradingBot) IsPositionClosed(ctx context.Context, positionID int) (bool, error) {
+	pos, err := bot.exchange.GetPositionDetails(ctx, positionID)
 	if err != nil {
 		return false, err
 	}
-	return pos.Status == "Closed", nil
+	return positionClosed(pos.Status), nil
+}
+
+func positionClosed(status string) bool {
+	return status == "Closed" || status == "Liquidated"
 }
@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// orderFeedTTL is how long a finished order's pushed state is kept.
+const orderFeedTTL = time.Hour
+
+// orderFeed keeps the final state the private stream pushed for the pair's
+// finished orders, and which private channels are subscribed.
+type orderFeed struct {
+	mu       sync.Mutex
+	live     map[string]bool // channel -> subscribed
+	finished map[int]nobitex.OrderEvent
+	seen     map[int]time.Time
+}
+
+func newOrderFeed() *orderFeed {
+	return &orderFeed{
+		live:     make(map[string]bool),
+		finished: make(map[int]nobitex.OrderEvent),
+		seen:     make(map[int]time.Time),
+	}
+}
+
+// setLive records whether channel is subscribed.
+func (f *orderFeed) setLive(channel string, live bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live[channel] = live
+}
+
+// clearLive records every channel as down, as after a disconnect.
+func (f *orderFeed) clearLive() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.live)
+}
+
+// isLive reports whether the private orders channel is subscribed. While it
+// is not, order and position status are polled.
+func (f *orderFeed) isLive() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for channel, live := range f.live {
+		if live && nobitex.IsPrivateOrdersChannel(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// update records ev if it finished its order.
+func (f *orderFeed) update(ev nobitex.OrderEvent, now time.Time) {
+	if !orderFinished(ev.Status) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.finished[ev.OrderID] = ev
+	f.seen[ev.OrderID] = now
+	for id, at := range f.seen {
+		if now.Sub(at) > orderFeedTTL {
+			delete(f.finished, id)
+			delete(f.seen, id)
+		}
+	}
+}
+
+// final returns the pushed final state of an order, if any.
+func (f *orderFeed) final(orderID int) (nobitex.OrderEvent, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ev, ok := f.finished[orderID]
+	return ev, ok
+}
+
+func orderFinished(status string) bool {
+	return status == "Done" || status == "Canceled"
+}
+
+// PrivateStreamHandler subscribes to the account's private order and trade
+// channels in the background, retrying with backoff until it succeeds or ctx
+// is cancelled. Until it is up, fills are found by polling.
+func (bot *TradingBot) PrivateStreamHandler(ctx context.Context) {
+	bot.wg.Add(1)
+	go func() {
+		defer bot.wg.Done()
+		cfg := bot.cfg.Stream
+		for attempt := 1; ; attempt++ {
+			err := bot.exchange.SubscribePrivate(ctx, nobitex.PrivateHandlers{
+				OnConnected: func() {
+					bot.openLogger.Info("Connected to private WebSocket!")
+				},
+				OnDisconnected: func(reason string) {
+					bot.orders.clearLive()
+					bot.openLogger.WithField("reason", reason).
+						Warn("Disconnected from private WebSocket: polling order and position status")
+				},
+				OnSubscribed: func(channel string, recovered bool) {
+					bot.orders.setLive(channel, true)
+					bot.openLogger.WithFields(logrus.Fields{"channel": channel, "recovered": recovered}).
+						Info("Subscribed to private channel")
+				},
+				OnError: func(err error) {
+					var streamErr *nobitex.StreamError
+					if errors.As(err, &streamErr) {
+						bot.orders.setLive(streamErr.Channel, false)
+					}
+					bot.openLogger.WithError(err).Error("Private stream error")
+				},
+				OnOrder: func(ev nobitex.OrderEvent) { bot.onOrderEvent(ctx, ev) },
+				OnTrade: func(t nobitex.UserTrade) { bot.onUserTrade(ctx, t) },
+			})
+			if err == nil {
+				return
+			}
+			delay := min(cfg.ReconnectMin<<min(attempt-1, 16), cfg.ReconnectMax)
+			bot.openLogger.WithError(err).WithField("next_retry", delay.String()).
+				Error("Failed to subscribe to private channels: polling order and position status")
+			if nobitex.IsAuth(err) || !sleep(ctx, delay) {
+				return
+			}
+		}
+	}()
+}
+
+// onOrderEvent records a finished order of the pair and wakes the entry
+// loops. A finished exit leg gets its position checked straight away; a filled
+// entry wakes the main loop to protect the new position.
+func (bot *TradingBot) onOrderEvent(ctx context.Context, ev nobitex.OrderEvent) {
+	if ctx.Err() != nil {
+		return
+	}
+	market := bot.market()
+	if ev.SrcCurrency != market.Src || ev.DstCurrency != market.Dst {
+		return
+	}
+	bot.orders.update(ev, time.Now())
+	if !orderFinished(ev.Status) {
+		return
+	}
+	bot.entryWake.notify()
+	bot.openLogger.WithFields(logrus.Fields{
+		"order_id": ev.OrderID,
+		"side":     ev.Side,
+		"status":   ev.Status,
+		"matched":  ev.Matched,
+	}).Debug("Order event")
+	if positionID, ok := bot.exitPosition(ev.OrderID); ok {
+		bot.checkPositionClosedAsync(ctx, positionID)
+	} else if ev.Status == "Done" {
+		bot.events.notify(fillEvent)
+	}
+}
+
+// onUserTrade reacts to a fill of one of the pair's orders like onOrderEvent,
+// so partial fills are acted on too.
+func (bot *TradingBot) onUserTrade(ctx context.Context, t nobitex.UserTrade) {
+	if ctx.Err() != nil {
+		return
+	}
+	market := bot.market()
+	if t.SrcCurrency != market.Src || t.DstCurrency != market.Dst {
+		return
+	}
+	if positionID, ok := bot.exitPosition(t.OrderID); ok {
+		bot.checkPositionClosedAsync(ctx, positionID)
+		return
+	}
+	bot.events.notify(fillEvent)
+}
+
+// exitPosition returns the position an exit order closes, if it is one of
+// the tracked exit legs.
+func (bot *TradingBot) exitPosition(orderID int) (int, bool) {
+	bot.exitMu.Lock()
+	defer bot.exitMu.Unlock()
+	for positionID, exits := range bot.exits {
+		for _, leg := range exits.legs {
+			if leg.orderID == orderID {
+				return positionID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// checkPositionClosedAsync runs checkPositionClosed in the background, unless
+// the bot is shutting down.
+func (bot *TradingBot) checkPositionClosedAsync(ctx context.Context, positionID int) {
+	if ctx.Err() != nil {
+		return
+	}
+	bot.wg.Add(1)
+	go func() {
+		defer bot.wg.Done()
+		bot.checkPositionClosed(ctx, positionID)
+	}()
+}
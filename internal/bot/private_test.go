@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+func TestOrderFeedFinished(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newOrderFeed()
+
+	tests := []struct {
+		name  string
+		event nobitex.OrderEvent
+		at    time.Time
+		kept  bool
+	}{
+		{"active order ignored", nobitex.OrderEvent{OrderID: 1, Status: "Active"}, now, false},
+		{"inactive stop ignored", nobitex.OrderEvent{OrderID: 2, Status: "Inactive"}, now, false},
+		{"filled order kept", nobitex.OrderEvent{OrderID: 3, Status: "Done", Matched: 0.5}, now, true},
+		{"cancelled order kept", nobitex.OrderEvent{OrderID: 4, Status: "Canceled", Matched: 0.1}, now.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		f.update(tt.event, tt.at)
+		got, ok := f.final(tt.event.OrderID)
+		if ok != tt.kept {
+			t.Errorf("%s: kept = %v, want %v", tt.name, ok, tt.kept)
+		}
+		if ok && got != tt.event {
+			t.Errorf("%s: final = %+v, want %+v", tt.name, got, tt.event)
+		}
+	}
+
+	// A later event evicts the finished orders older than the TTL.
+	f.update(nobitex.OrderEvent{OrderID: 5, Status: "Done"}, now.Add(orderFeedTTL+30*time.Second))
+	if _, ok := f.final(3); ok {
+		t.Error("order 3 kept past the TTL")
+	}
+	if _, ok := f.final(4); !ok {
+		t.Error("order 4 evicted before the TTL")
+	}
+	if _, ok := f.final(5); !ok {
+		t.Error("order 5 not kept")
+	}
+}
+
+func TestOrderFeedLive(t *testing.T) {
+	const (
+		orders = "private:orders#abc"
+		trades = "private:trades#abc"
+	)
+	f := newOrderFeed()
+	if f.isLive() {
+		t.Fatal("live before any subscription")
+	}
+
+	f.setLive(trades, true)
+	if f.isLive() {
+		t.Fatal("live with only the trades channel")
+	}
+	f.setLive(orders, true)
+	if !f.isLive() {
+		t.Fatal("not live with the orders channel subscribed")
+	}
+
+	f.setLive(orders, false)
+	if f.isLive() {
+		t.Fatal("live after the orders channel failed")
+	}
+
+	f.setLive(orders, true)
+	f.clearLive()
+	if f.isLive() {
+		t.Fatal("live after a disconnect")
+	}
+}
@@ -0,0 +1,311 @@
+package bot
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
+)
+
+// reconcile lines the bot up with what already exists on the exchange before
+// the main loop starts. Only close orders the bot can vouch for are adopted as
+// a position's exits: those the store recorded for it, with the stop legs of
+// their OCOs, and otherwise well-formed OCO pairs on its closing side. A
+// position whose adopted orders would close more than its liability in orders
+// is left unadopted. Entry orders the store recorded as working are cancelled;
+// any other open order on the pair, such as one placed by hand or by another
+// tool, is logged and left alone. Everything done is written to the close log.
+func (bot *TradingBot) reconcile(ctx context.Context) {
+	if bot.store != nil {
+		if last, ok, err := bot.store.State(bot.currencyPair); err != nil {
+			bot.closeLogger.WithError(err).Error("Error reading saved state")
+		} else if ok {
+			bot.closeLogger.WithFields(logrus.Fields{
+				"last_loop_at":   last.LastLoopAt,
+				"position_count": last.PositionCount,
+				"exposure":       last.Exposure,
+			}).Info("Resuming from saved state")
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		positions, err := bot.openPositions(ctx)
+		if err == nil {
+			var orders []nobitex.Order
+			if orders, err = bot.exchange.GetOpenMarginOrders(ctx, bot.currencyPair); err == nil {
+				bot.reconcileOrders(ctx, positions, orders)
+				return
+			}
+		}
+		if nobitex.IsPermanent(err) {
+			bot.closeLogger.WithError(err).Error("Reconciliation failed; trusting saved exit orders")
+			bot.trustSavedExits()
+			return
+		}
+		delay := retryDelay(err, 2*time.Second, attempt)
+		bot.closeLogger.WithError(err).WithField("next_retry", delay.String()).Warn("Reconciliation failed; retrying")
+		if !sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// trustSavedExits adopts the stored exits as they are. Without the exchange's
+// view, that is safer than placing a second OCO on every position.
+func (bot *TradingBot) trustSavedExits() {
+	if bot.store == nil {
+		return
+	}
+	records, err := bot.store.Positions(bot.currencyPair)
+	if err != nil {
+		bot.closeLogger.WithError(err).Error("Error reading saved positions")
+		return
+	}
+	for _, rec := range records {
+		var legs []*exitLeg
+		for _, e := range rec.Exits {
+			legs = append(legs, storedLeg(e))
+		}
+		bot.restoreExits(nobitex.Position{ID: rec.PositionID, Side: rec.Side}, 0, 0, rec, legs)
+	}
+}
+
+func (bot *TradingBot) reconcileOrders(ctx context.Context, positions []nobitex.Position, orders []nobitex.Order) {
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	open := make(map[int]nobitex.Order, len(orders))
+	for _, o := range orders {
+		open[o.ID] = o
+	}
+	openPositions := make(map[int]nobitex.Position, len(positions))
+	for _, pos := range positions {
+		openPositions[pos.ID] = pos
+	}
+
+	claimed := make(map[int]bool)
+	saved := make(map[int]store.PositionRecord)
+	var entries []store.EntryOrderRecord
+	isEntry := make(map[int]bool)
+
+	if bot.store != nil {
+		var err error
+		if entries, err = bot.store.EntryOrders(bot.currencyPair); err != nil {
+			bot.closeLogger.WithError(err).Error("Error reading saved entry orders")
+		}
+		for _, rec := range entries {
+			isEntry[rec.OrderID] = true
+		}
+
+		records, err := bot.store.Positions(bot.currencyPair)
+		if err != nil {
+			bot.closeLogger.WithError(err).Error("Error reading saved positions")
+		}
+		for _, rec := range records {
+			if _, ok := openPositions[rec.PositionID]; !ok {
+				bot.closedOffline(ctx, rec)
+				continue
+			}
+			saved[rec.PositionID] = rec
+		}
+	}
+
+	adopted := 0
+	for _, pos := range positions {
+		legs, ids := matchExits(pos, saved[pos.ID], orders, claimed, isEntry)
+		if len(legs) == 0 {
+			bot.forgetPosition(pos.ID)
+			bot.closeLogger.WithField("position_id", pos.ID).Info("Open position has no close order; an OCO will be placed")
+			continue
+		}
+
+		total := 0.0
+		for _, leg := range legs {
+			total += leg.amount
+		}
+		limit, err := strconv.ParseFloat(pos.LiabilityInOrder, 64)
+		if err != nil {
+			limit, _ = strconv.ParseFloat(pos.Liability, 64)
+		}
+		if total > limit*(1+1e-9) {
+			for _, id := range ids {
+				delete(claimed, id)
+			}
+			bot.forgetPosition(pos.ID)
+			bot.closeLogger.WithFields(logrus.Fields{
+				"position_id":        pos.ID,
+				"order_ids":          ids,
+				"amount":             total,
+				"liability_in_order": pos.LiabilityInOrder,
+			}).Error("Close orders found for position exceed its liability in orders; not adopting them, check the position by hand")
+			continue
+		}
+
+		entry, _ := strconv.ParseFloat(pos.EntryPrice, 64)
+		liability, _ := strconv.ParseFloat(pos.Liability, 64)
+		bot.restoreExits(pos, entry, liability, saved[pos.ID], legs)
+		adopted++
+		bot.closeLogger.WithFields(logrus.Fields{
+			"position_id": pos.ID,
+			"order_ids":   ids,
+		}).Info("Matched close orders to open position")
+	}
+
+	// Of the rest, only entry orders the store recorded are the bot's own.
+	cancelled, unknown := 0, 0
+	for _, o := range orders {
+		if claimed[o.ID] {
+			continue
+		}
+		fields := logrus.Fields{
+			"order_id":  o.ID,
+			"type":      o.Type,
+			"execution": o.Execution,
+			"price":     o.Price,
+			"amount":    o.Amount,
+			"matched":   o.MatchedAmount,
+		}
+		if !isEntry[o.ID] {
+			unknown++
+			bot.closeLogger.WithFields(fields).Warn("Unknown open order on the pair; leaving it alone")
+			continue
+		}
+		if err := bot.exchange.CancelOrder(ctx, o.ID); err != nil {
+			bot.closeLogger.WithFields(fields).WithError(err).Error("Failed to cancel stray entry order")
+			continue
+		}
+		cancelled++
+		bot.forgetEntryOrder(o.ID)
+		bot.closeLogger.WithFields(fields).Info("Cancelled stray entry order")
+	}
+
+	// Stored entry orders that are no longer open were filled or cancelled.
+	for _, rec := range entries {
+		if _, ok := open[rec.OrderID]; !ok {
+			bot.forgetEntryOrder(rec.OrderID)
+		}
+	}
+
+	bot.closeLogger.WithFields(logrus.Fields{
+		"positions":          len(positions),
+		"open_orders":        len(orders),
+		"positions_with_oco": adopted,
+		"cancelled_entries":  cancelled,
+		"unknown_orders":     unknown,
+	}).Info("Reconciliation complete")
+}
+
+// matchExits picks the open orders that close pos: first the exits stored for
+// it, then unrecorded OCO pairs, a limit and a stop order on its closing side
+// for the same amount. The stop leg of each OCO is claimed along with it. It
+// returns the legs and the IDs of every order claimed, which are marked in
+// claimed.
+func matchExits(pos nobitex.Position, rec store.PositionRecord, orders []nobitex.Order, claimed, isEntry map[int]bool) ([]*exitLeg, []int) {
+	side := closingSide(pos.Side)
+	var (
+		legs []*exitLeg
+		ids  []int
+	)
+	usable := func(o nobitex.Order) bool {
+		return !claimed[o.ID] && !isEntry[o.ID] && o.Type == side
+	}
+	claim := func(o nobitex.Order) {
+		claimed[o.ID] = true
+		ids = append(ids, o.ID)
+	}
+	// sibling finds the unclaimed stop leg of an OCO whose limit leg is o.
+	sibling := func(o nobitex.Order) (nobitex.Order, bool) {
+		for _, s := range orders {
+			if usable(s) && isStopOrder(s) && sameAmount(remainingAmount(s), remainingAmount(o)) {
+				return s, true
+			}
+		}
+		return nobitex.Order{}, false
+	}
+
+	for _, e := range rec.Exits {
+		var o nobitex.Order
+		found := false
+		for _, candidate := range orders {
+			if candidate.ID == e.OrderID {
+				o, found = candidate, true
+				break
+			}
+		}
+		if !found || !usable(o) {
+			continue
+		}
+		if isStopOrder(o) {
+			// Records from older versions also listed the OCO's stop leg.
+			claim(o)
+			continue
+		}
+		claim(o)
+		leg := storedLeg(e)
+		if leg.amount == 0 {
+			leg.amount = remainingAmount(o)
+		}
+		legs = append(legs, leg)
+		if !leg.close {
+			if s, ok := sibling(o); ok {
+				claim(s)
+			}
+		}
+	}
+
+	for _, o := range orders {
+		if !usable(o) || isStopOrder(o) {
+			continue
+		}
+		s, ok := sibling(o)
+		if !ok {
+			continue
+		}
+		claim(o)
+		claim(s)
+		price, _ := strconv.ParseFloat(o.Price, 64)
+		legs = append(legs, &exitLeg{orderID: o.ID, amount: remainingAmount(o), takeProfit: price})
+	}
+	return legs, ids
+}
+
+// remainingAmount is the part of an order still to fill.
+func remainingAmount(o nobitex.Order) float64 {
+	if unmatched, err := strconv.ParseFloat(o.UnmatchedAmount, 64); err == nil && unmatched > 0 {
+		return unmatched
+	}
+	amount, _ := strconv.ParseFloat(o.Amount, 64)
+	return amount
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(a, b)
+}
+
+// closedOffline forgets a stored position that closed while the bot was down
+// and records its PnL. If the position can't be fetched its record is kept,
+// so the next start tries again.
+func (bot *TradingBot) closedOffline(ctx context.Context, rec store.PositionRecord) {
+	details, err := bot.exchange.GetPositionDetails(ctx, rec.PositionID)
+	if err != nil {
+		bot.closeLogger.WithFields(logrus.Fields{
+			"position_id": rec.PositionID,
+			"error":       err.Error(),
+		}).Error("Error checking position status")
+		return
+	}
+	bot.forgetPosition(rec.PositionID)
+	bot.closeLogger.WithFields(logrus.Fields{"position_id": rec.PositionID, "status": details.Status}).
+		Info("Position closed while offline. Removed from OCO.")
+	if !positionClosed(details.Status) {
+		return
+	}
+	size := 0.0
+	for _, e := range rec.Exits {
+		size += e.Amount
+	}
+	bot.recordClose(ctx, *details, &positionExits{side: rec.Side, size: size})
+}
@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/markets"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
+)
+
+// ledgerExchange serves a fixed set of open positions and orders, and the
+// details of closed positions, recording the orders cancelled.
+type ledgerExchange struct {
+	Exchange
+
+	positions    []nobitex.Position
+	orders       []nobitex.Order
+	details      map[int]*nobitex.Position
+	positionsErr error
+
+	mu        sync.Mutex
+	cancelled []int
+}
+
+func (e *ledgerExchange) GetOpenPositions(ctx context.Context, srcCurrency, dstCurrency string) ([]nobitex.Position, error) {
+	return e.positions, e.positionsErr
+}
+
+func (e *ledgerExchange) GetOpenMarginOrders(ctx context.Context, currencyPair string) ([]nobitex.Order, error) {
+	return append([]nobitex.Order(nil), e.orders...), nil
+}
+
+func (e *ledgerExchange) GetPositionDetails(ctx context.Context, positionID int) (*nobitex.Position, error) {
+	if pos, ok := e.details[positionID]; ok {
+		return pos, nil
+	}
+	return nil, errors.New("position not found")
+}
+
+func (e *ledgerExchange) CancelOrder(ctx context.Context, orderID int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancelled = append(e.cancelled, orderID)
+	return nil
+}
+
+// newStoreBot returns a bot on BTCIRT trading on exchange, with a fresh store
+// and loss guard.
+func newStoreBot(t *testing.T, exchange Exchange) *TradingBot {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := DefaultConfig()
+	return &TradingBot{
+		cfg:          cfg,
+		exchange:     exchange,
+		guard:        NewLossGuard(cfg, st),
+		markets:      markets.NewRegistry(nil, 0),
+		currencyPair: "BTCIRT",
+		openLogger:   logger,
+		closeLogger:  logger,
+		exits:        make(map[int]*positionExits),
+		store:        st,
+	}
+}
+
+func longPosition(id int, liability string) nobitex.Position {
+	return nobitex.Position{ID: id, Side: "buy", Status: "Open", EntryPrice: "100", Liability: liability, LiabilityInOrder: liability}
+}
+
+func closeOrder(id int, execution, price, amount string) nobitex.Order {
+	return nobitex.Order{ID: id, Type: "sell", Execution: execution, Price: price, Amount: amount, Status: "Active"}
+}
+
+func TestReconcileOrders(t *testing.T) {
+	pnl := func(v string) *string { return &v }
+
+	tests := []struct {
+		name      string
+		positions []nobitex.Position
+		orders    []nobitex.Order
+		details   map[int]*nobitex.Position
+		saved     []store.PositionRecord
+		entries   []store.EntryOrderRecord
+
+		wantLegs      map[int][]exitLeg // adopted exits by position
+		wantCancelled []int
+		wantSaved     []int // positions still in the store
+		wantEntries   []int // entry orders still in the store
+		wantPnL       float64
+	}{
+		{
+			name:      "recorded OCO adopted",
+			positions: []nobitex.Position{longPosition(1, "1")},
+			orders: []nobitex.Order{
+				closeOrder(11, "Limit", "110", "1"),
+				closeOrder(12, "StopLimit", "94", "1"),
+			},
+			saved: []store.PositionRecord{{Pair: "BTCIRT", PositionID: 1, Side: "buy", Stop: 95, Exits: []store.ExitRecord{
+				{OrderID: 11, Amount: 1, TakeProfit: 110, StopLoss: 95},
+			}}},
+			wantLegs:  map[int][]exitLeg{1: {{orderID: 11, amount: 1, takeProfit: 110, stop: 95, runner: true}}},
+			wantSaved: []int{1},
+		},
+		{
+			name:      "well-formed unrecorded OCO adopted",
+			positions: []nobitex.Position{longPosition(2, "0.5")},
+			orders: []nobitex.Order{
+				closeOrder(21, "Limit", "120", "0.5"),
+				closeOrder(22, "StopLimit", "90", "0.5"),
+			},
+			wantLegs:  map[int][]exitLeg{2: {{orderID: 21, amount: 0.5, takeProfit: 120, runner: true}}},
+			wantSaved: []int{2},
+		},
+		{
+			name:      "unknown orders left alone",
+			positions: []nobitex.Position{longPosition(3, "1")},
+			orders: []nobitex.Order{
+				closeOrder(31, "Limit", "110", "1"), // no stop leg beside it
+				{ID: 32, Type: "buy", Execution: "Limit", Price: "90", Amount: "2", Status: "Active"},
+			},
+			wantLegs: map[int][]exitLeg{},
+		},
+		{
+			name:      "OCO larger than the position not adopted",
+			positions: []nobitex.Position{longPosition(4, "0.5")},
+			orders: []nobitex.Order{
+				closeOrder(41, "Limit", "110", "1"),
+				closeOrder(42, "StopLimit", "94", "1"),
+			},
+			wantLegs: map[int][]exitLeg{},
+		},
+		{
+			name:      "saved exits whose orders are gone dropped",
+			positions: []nobitex.Position{longPosition(5, "1")},
+			saved: []store.PositionRecord{{Pair: "BTCIRT", PositionID: 5, Side: "buy", Exits: []store.ExitRecord{
+				{OrderID: 51, Amount: 1, TakeProfit: 110, StopLoss: 95},
+			}}},
+			wantLegs: map[int][]exitLeg{},
+		},
+		{
+			name:   "recorded entry orders cancelled or forgotten",
+			orders: []nobitex.Order{{ID: 61, Type: "buy", Execution: "Limit", Price: "99", Amount: "1", Status: "Active"}},
+			entries: []store.EntryOrderRecord{
+				{Pair: "BTCIRT", OrderID: 61, Side: "buy", Amount: 1, Price: 99},
+				{Pair: "BTCIRT", OrderID: 62, Side: "buy", Amount: 1, Price: 98}, // filled or cancelled while down
+			},
+			wantLegs:      map[int][]exitLeg{},
+			wantCancelled: []int{61},
+		},
+		{
+			name: "PnL recorded for positions closed while down",
+			details: map[int]*nobitex.Position{
+				7: {ID: 7, Side: "buy", Status: "Closed", EntryPrice: "100", PNL: pnl("-250")},
+				8: {ID: 8, Side: "sell", Status: "Liquidated", EntryPrice: "100", ExitPrice: pnl("110")},
+			},
+			saved: []store.PositionRecord{
+				{Pair: "BTCIRT", PositionID: 7, Side: "buy", Exits: []store.ExitRecord{{OrderID: 71, Amount: 1}}},
+				{Pair: "BTCIRT", PositionID: 8, Side: "sell", Exits: []store.ExitRecord{{OrderID: 81, Amount: 2}, {OrderID: 82, Amount: 3}}},
+				{Pair: "BTCIRT", PositionID: 9, Side: "buy"}, // details unavailable: kept for the next start
+			},
+			wantLegs:  map[int][]exitLeg{},
+			wantSaved: []int{9},
+			wantPnL:   -250 + (100-110)*5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange := &ledgerExchange{positions: tt.positions, orders: tt.orders, details: tt.details}
+			bot := newStoreBot(t, exchange)
+			for _, rec := range tt.saved {
+				if err := bot.store.SavePosition(rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rec := range tt.entries {
+				if err := bot.store.SaveEntryOrder(rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			bot.reconcile(context.Background())
+
+			legs := make(map[int][]exitLeg)
+			for id, exits := range bot.exits {
+				for _, leg := range exits.legs {
+					legs[id] = append(legs[id], *leg)
+				}
+			}
+			if !reflect.DeepEqual(legs, tt.wantLegs) {
+				t.Errorf("adopted legs = %+v, want %+v", legs, tt.wantLegs)
+			}
+			if !reflect.DeepEqual(exchange.cancelled, tt.wantCancelled) {
+				t.Errorf("cancelled = %v, want %v", exchange.cancelled, tt.wantCancelled)
+			}
+
+			records, err := bot.store.Positions(bot.currencyPair)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved []int
+			for _, rec := range records {
+				saved = append(saved, rec.PositionID)
+			}
+			sort.Ints(saved)
+			if !reflect.DeepEqual(saved, tt.wantSaved) {
+				t.Errorf("saved positions = %v, want %v", saved, tt.wantSaved)
+			}
+
+			entries, err := bot.store.EntryOrders(bot.currencyPair)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entryIDs []int
+			for _, rec := range entries {
+				entryIDs = append(entryIDs, rec.OrderID)
+			}
+			if !reflect.DeepEqual(entryIDs, tt.wantEntries) {
+				t.Errorf("saved entry orders = %v, want %v", entryIDs, tt.wantEntries)
+			}
+
+			if rec := bot.guard.rec; rec.TotalPnL != tt.wantPnL {
+				t.Errorf("recorded PnL = %v, want %v", rec.TotalPnL, tt.wantPnL)
+			}
+		})
+	}
+}
+
+func TestReconcileTrustsSavedExitsOnPermanentError(t *testing.T) {
+	exchange := &ledgerExchange{positionsErr: &nobitex.APIError{HTTPStatus: 401, Code: "InvalidToken"}}
+	bot := newStoreBot(t, exchange)
+	rec := store.PositionRecord{Pair: "BTCIRT", PositionID: 1, Side: "sell", BreakEven: true, Stop: 100, Exits: []store.ExitRecord{
+		{OrderID: 11, Amount: 0.5, TakeProfit: 90, StopLoss: 100},
+		{OrderID: 12, Amount: 0.5, TakeProfit: 80, StopLoss: 100, Runner: true},
+	}}
+	if err := bot.store.SavePosition(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	bot.reconcile(context.Background())
+
+	exits, ok := bot.exits[1]
+	if !ok {
+		t.Fatal("saved exits not adopted")
+	}
+	if len(exits.legs) != 2 || exits.legs[0].orderID != 11 || !exits.legs[1].runner || !exits.breakEven || exits.stop != 100 {
+		t.Errorf("adopted exits = %+v", exits)
+	}
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"nobitex-sma-bot/internal/markets"
+	"nobitex-sma-bot/internal/store"
+	"sync"
+)
+
+// RunPairs runs one TradingBot per configured pair on a shared exchange and
+// state store, with one Allocator per margin wallet dividing its balance
+// between the pairs quoted in it, a common LossGuard halting them all and a
+// common cache of market rules. cfg must already be validated. It returns once
+// ctx is cancelled and every bot has shut down.
+func RunPairs(ctx context.Context, exchange Exchange, cfg Config, st *store.Store) {
+	guard := NewLossGuard(cfg, st)
+	registry := markets.NewRegistry(exchange, cfg.Intervals.Markets)
+	if err := registry.Refresh(ctx); err != nil {
+		log.Printf("Error fetching market rules; parsing currencies from pair symbols: %v", err)
+	}
+
+	// Pairs quoted in different currencies trade from different wallets.
+	wallets := make(map[string][]PairSettings)
+	for _, pair := range cfg.Pairs {
+		dst := registry.Market(pair.Symbol).Dst
+		wallets[dst] = append(wallets[dst], pair)
+	}
+	allocators := make(map[string]*Allocator, len(wallets))
+	for dst, pairs := range wallets {
+		walletCfg := cfg
+		walletCfg.Pairs = pairs
+		allocators[dst] = NewAllocator(walletCfg)
+	}
+
+	var wg sync.WaitGroup
+	for _, pair := range cfg.Pairs {
+		allocator := allocators[registry.Market(pair.Symbol).Dst]
+		tradingBot := NewTradingBot(pair.Symbol, exchange, cfg, allocator, guard, registry, st)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tradingBot.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
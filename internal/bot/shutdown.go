@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/logs"
+)
+
+// flattenSlippage is how far through the top of book flattening close orders
+// are priced, so they fill at once.
+const flattenSlippage = 0.005
+
+// shutdown runs once the main loop has stopped. The order loops cancel their
+// resting entry orders as they exit; once every goroutine is done, open
+// positions are optionally flattened and the log files are flushed.
+func (bot *TradingBot) shutdown() {
+	bot.openLogger.Info("Shutting down: no new positions will be opened")
+	bot.wg.Wait()
+
+	if bot.cfg.Shutdown.Flatten {
+		ctx, cancel := context.WithTimeout(context.Background(), bot.cfg.Shutdown.Timeout)
+		bot.flattenPositions(ctx)
+		cancel()
+	}
+
+	bot.openLogger.Info("Shutdown complete")
+	for _, logger := range []*logrus.Logger{bot.openLogger, bot.closeLogger} {
+		if err := logs.Close(logger); err != nil {
+			logrus.WithError(err).Error("Error closing log file")
+		}
+	}
+}
+
+// flattenPositions cancels the exit orders of every open position and closes
+// it with a limit order priced through the book.
+func (bot *TradingBot) flattenPositions(ctx context.Context) {
+	positions, err := bot.openPositions(ctx)
+	if err != nil {
+		bot.closeLogger.WithError(err).Error("Error fetching positions to flatten")
+		return
+	}
+
+	bot.priceMu.RLock()
+	bestBid := bot.bidBest
+	bestAsk := bot.askBest
+	bot.priceMu.RUnlock()
+
+	for _, pos := range positions {
+		fields := logrus.Fields{"position_id": pos.ID, "side": pos.Side}
+
+		var legs []*exitLeg
+		var size float64
+		bot.exitMu.Lock()
+		if exits, ok := bot.exits[pos.ID]; ok {
+			legs, size = exits.legs, exits.size
+		}
+		bot.exitMu.Unlock()
+		cancelled := true
+		for _, leg := range legs {
+			if err := bot.exchange.CancelOrder(ctx, leg.orderID); err != nil {
+				bot.closeLogger.WithFields(fields).WithField("order_id", leg.orderID).WithError(err).Error("Failed to cancel OCO before flattening")
+				cancelled = false
+			}
+		}
+		if !cancelled {
+			continue
+		}
+
+		liability, err := strconv.ParseFloat(pos.Liability, 64)
+		if err != nil {
+			bot.closeLogger.WithFields(fields).WithError(err).Error("Error parsing liability for flattening")
+			continue
+		}
+		rules := bot.marketRules()
+		price := rules.RoundPriceDown(bestBid * (1 - flattenSlippage))
+		if pos.Side == "sell" {
+			price = rules.RoundPriceUp(bestAsk * (1 + flattenSlippage))
+		}
+		if price <= 0 {
+			bot.closeLogger.WithFields(fields).Error("No order book price to flatten at")
+			continue
+		}
+
+		orderID, err := bot.exchange.ClosePosition(ctx, pos.ID, liability, price)
+		if err != nil {
+			bot.closeLogger.WithFields(fields).WithError(err).Error("Failed to flatten position")
+			continue
+		}
+		bot.exitMu.Lock()
+		bot.exits[pos.ID] = &positionExits{
+			side:      pos.Side,
+			liability: liability,
+			size:      max(size, liability),
+			legs:      []*exitLeg{{orderID: orderID, amount: liability, close: true}},
+		}
+		bot.exitMu.Unlock()
+		bot.saveExits(pos.ID)
+		fields["order_id"] = orderID
+		fields["price"] = price
+		fields["amount"] = liability
+		bot.closeLogger.WithFields(fields).Info("Position flattened on shutdown")
+	}
+}
@@ -0,0 +1,37 @@
+package bot
+
+// EntrySide decides whether the top of book has strayed far enough from the
+// SMA to open a position: "buy" below the band, "sell" above it, "" otherwise.
+func EntrySide(bidBest, askBest, sma, deviation float64) string {
+	switch {
+	case bidBest <= sma*(1-deviation):
+		return "buy"
+	case askBest >= sma*(1+deviation):
+		return "sell"
+	}
+	return ""
+}
+
+// ExitPrices returns the OCO take-profit and stop-loss prices for a position
+// opened on side at entryPrice, never worse than the current top of book.
+func ExitPrices(side string, entryPrice, bestBid, bestAsk, profitTarget, stopLoss float64) (float64, float64) {
+	var takeProfitPrice, stopLossPrice float64
+	switch side {
+	case "buy":
+		takeProfitPrice = max(entryPrice*(1+profitTarget), bestBid)
+		stopLossPrice = min(entryPrice*(1-stopLoss), bestBid)
+	case "sell":
+		takeProfitPrice = min(entryPrice*(1-profitTarget), bestAsk)
+		stopLossPrice = max(entryPrice*(1+stopLoss), bestAsk)
+	}
+	return takeProfitPrice, stopLossPrice
+}
+
+// SMA returns the simple moving average of prices.
+func SMA(prices []float64) float64 {
+	var sum float64
+	for _, p := range prices {
+		sum += p
+	}
+	return sum / float64(len(prices))
+}
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// entrySize is the notional in rials the sizing mode wants the next entry to
+// commit at price, capped by sizing.max_notional and the pair's remaining cap.
+// The allocator still checks it against the free balance.
+func (bot *TradingBot) entrySize(balance, price float64) float64 {
+	cfg := bot.cfg.Sizing
+	remaining := bot.allocator.Remaining(bot.currencyPair)
+	equity := bot.allocator.Equity(balance)
+
+	var size float64
+	switch cfg.Mode {
+	case "fixed":
+		size = remaining
+		if cfg.Notional > 0 {
+			size = cfg.Notional
+		}
+	case "equity":
+		size = equity * cfg.EquityFraction
+	case "risk":
+		// Losing risk.stop_loss of the notional costs risk_fraction of equity.
+		size = equity * cfg.RiskFraction / bot.cfg.Risk.StopLoss
+	case "volatility":
+		atr := bot.sizeATR.value()
+		if atr == 0 {
+			return 0
+		}
+		// A move of one ATR changes the position's value by volatility_target of equity.
+		size = equity * cfg.VolatilityTarget * price / atr
+	}
+	if cfg.MaxNotional > 0 {
+		size = min(size, cfg.MaxNotional)
+	}
+
+	bot.openLogger.WithFields(logrus.Fields{
+		"mode":      cfg.Mode,
+		"equity":    equity,
+		"remaining": remaining,
+		"size":      min(size, remaining),
+	}).Debug("Entry size")
+	return min(size, remaining)
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"context"
+	"nobitex-sma-bot/internal/nobitex"
+	"nobitex-sma-bot/internal/store"
+	"time"
+)
+
+// market is the bot's pair with its currencies as the exchange names them.
+func (bot *TradingBot) market() nobitex.Market {
+	return bot.markets.Market(bot.currencyPair)
+}
+
+// openPositions fetches the open positions on the bot's pair, leaving out
+// those in the same source currency quoted elsewhere.
+func (bot *TradingBot) openPositions(ctx context.Context) ([]nobitex.Position, error) {
+	m := bot.market()
+	return bot.exchange.GetOpenPositions(ctx, m.Src, m.Dst)
+}
+
+// orderIsOpen reports whether an order status means it can still fill.
+func orderIsOpen(status string) bool {
+	return status == "Active" || status == "Inactive" || status == "New"
+}
+
+func (bot *TradingBot) forgetPosition(positionID int) {
+	if bot.store == nil {
+		return
+	}
+	if err := bot.store.DeletePosition(bot.currencyPair, positionID); err != nil {
+		bot.closeLogger.WithError(err).WithField("position_id", positionID).Error("Error deleting position state")
+	}
+}
+
+// rememberEntryOrder persists a working entry order placed by a buy/sell loop.
+func (bot *TradingBot) rememberEntryOrder(orderID int, side string, amount, price float64) {
+	if bot.store == nil {
+		return
+	}
+	err := bot.store.SaveEntryOrder(store.EntryOrderRecord{
+		Pair:     bot.currencyPair,
+		OrderID:  orderID,
+		Side:     side,
+		Amount:   amount,
+		Price:    price,
+		PlacedAt: time.Now(),
+	})
+	if err != nil {
+		bot.openLogger.WithError(err).WithField("order_id", orderID).Error("Error saving entry order")
+	}
+}
+
+func (bot *TradingBot) forgetEntryOrder(orderID int) {
+	if bot.store == nil || orderID == 0 {
+		return
+	}
+	if err := bot.store.DeleteEntryOrder(bot.currencyPair, orderID); err != nil {
+		bot.openLogger.WithError(err).WithField("order_id", orderID).Error("Error deleting entry order")
+	}
+}
+
+// saveState records what the main loop last processed.
+func (bot *TradingBot) saveState() {
+	if bot.store == nil {
+		return
+	}
+	bot.posMutex.Lock()
+	state := store.PairState{
+		Pair:          bot.currencyPair,
+		LastLoopAt:    time.Now(),
+		PositionCount: bot.positionCount,
+		Exposure:      bot.balanceInPositions,
+	}
+	bot.posMutex.Unlock()
+	if err := bot.store.SaveState(state); err != nil {
+		bot.openLogger.WithError(err).Error("Error saving state")
+	}
+}
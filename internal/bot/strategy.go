@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"fmt"
+	"nobitex-sma-bot/internal/indicators"
+	"nobitex-sma-bot/internal/nobitex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Action is what a strategy wants the bot to do next.
+type Action int
+
+const (
+	Flat Action = iota
+	Long
+	Short
+)
+
+func (a Action) String() string {
+	switch a {
+	case Long:
+		return "long"
+	case Short:
+		return "short"
+	}
+	return "flat"
+}
+
+// Side returns the order side that opens a position for the action.
+func (a Action) Side() string {
+	switch a {
+	case Long:
+		return "buy"
+	case Short:
+		return "sell"
+	}
+	return ""
+}
+
+// Signal is a strategy's decision. Size is the notional to commit in rials;
+// zero leaves sizing to the bot. Values are logged alongside the decision.
+type Signal struct {
+	Action Action
+	Size   float64
+	Reason string
+	Values map[string]float64
+}
+
+// PositionState describes the bot's current exposure.
+type PositionState struct {
+	Count     int     // open positions on the pair
+	Exposure  float64 // notional held in positions
+	Available float64 // free margin balance
+}
+
+// MarketState is everything a strategy sees on each evaluation. Candle prices
+// are in the same units as the order book, oldest first. Flow is zero unless
+// stream.trades is set.
+type MarketState struct {
+	Candles  []nobitex.Candle
+	BidBest  float64
+	AskBest  float64
+	Flow     TradeFlow // public trades over stream.trade_window
+	Position PositionState
+}
+
+// Closes returns the close prices of the candles.
+func (s MarketState) Closes() []float64 {
+	closes := make([]float64, len(s.Candles))
+	for i, c := range s.Candles {
+		closes[i] = c.Close
+	}
+	return closes
+}
+
+// Strategy turns market state into an entry signal. Implementations must not
+// place orders themselves; the bot owns order placement and risk gating.
+type Strategy interface {
+	Name() string
+	Evaluate(state MarketState) Signal
+}
+
+// StrategyConfig carries the parameters a strategy is built from. Params holds
+// strategy-specific settings by name.
+type StrategyConfig struct {
+	Window         int
+	PriceDeviation float64
+	Params         map[string]float64
+}
+
+// Param returns a strategy-specific parameter or def when unset.
+func (c StrategyConfig) Param(name string, def float64) float64 {
+	if v, ok := c.Params[name]; ok {
+		return v
+	}
+	return def
+}
+
+// StrategyFactory builds a strategy from its configuration.
+type StrategyFactory func(cfg StrategyConfig) (Strategy, error)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = make(map[string]StrategyFactory)
+)
+
+// RegisterStrategy makes a strategy selectable by name. It panics on duplicates.
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, dup := strategies[name]; dup {
+		panic("bot: strategy registered twice: " + name)
+	}
+	strategies[name] = factory
+}
+
+// NewStrategy builds the registered strategy called name.
+func NewStrategy(name string, cfg StrategyConfig) (Strategy, error) {
+	strategiesMu.RLock()
+	factory, ok := strategies[strings.ToLower(name)]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(Strategies(), ", "))
+	}
+	return factory(cfg)
+}
+
+// Strategies lists registered strategy names.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterStrategy("sma", newSMADeviation)
+	RegisterStrategy("ema", newEMADeviation)
+	RegisterStrategy("bollinger", newBollingerBands)
+}
+
+// smaDeviation goes long when the best bid falls PriceDeviation below the SMA
+// of the last Window closes and short when the best ask rises as far above it.
+type smaDeviation struct {
+	window    int
+	deviation float64
+}
+
+func newSMADeviation(cfg StrategyConfig) (Strategy, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("sma: window must be positive, got %d", cfg.Window)
+	}
+	if cfg.PriceDeviation <= 0 {
+		return nil, fmt.Errorf("sma: price deviation must be positive, got %v", cfg.PriceDeviation)
+	}
+	return &smaDeviation{window: cfg.Window, deviation: cfg.PriceDeviation}, nil
+}
+
+func (s *smaDeviation) Name() string { return "sma" }
+
+func (s *smaDeviation) Evaluate(state MarketState) Signal {
+	if len(state.Candles) < s.window {
+		return Signal{Reason: "not_enough_data"}
+	}
+	closes := state.Closes()
+	sma := SMA(closes[len(closes)-s.window:])
+	values := map[string]float64{"SMA": sma}
+
+	switch EntrySide(state.BidBest, state.AskBest, sma, s.deviation) {
+	case "buy":
+		return Signal{Action: Long, Reason: "price_below_sma_threshold", Values: values}
+	case "sell":
+		return Signal{Action: Short, Reason: "price_above_sma_threshold", Values: values}
+	}
+	return Signal{Reason: "within_sma_band", Values: values}
+}
+
+// emaDeviation is smaDeviation around an EMA of the last Window closes, which
+// reacts faster to trends.
+type emaDeviation struct {
+	window    int
+	deviation float64
+}
+
+func newEMADeviation(cfg StrategyConfig) (Strategy, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("ema: window must be positive, got %d", cfg.Window)
+	}
+	if cfg.PriceDeviation <= 0 {
+		return nil, fmt.Errorf("ema: price deviation must be positive, got %v", cfg.PriceDeviation)
+	}
+	return &emaDeviation{window: cfg.Window, deviation: cfg.PriceDeviation}, nil
+}
+
+func (s *emaDeviation) Name() string { return "ema" }
+
+func (s *emaDeviation) Evaluate(state MarketState) Signal {
+	if len(state.Candles) < s.window {
+		return Signal{Reason: "not_enough_data"}
+	}
+	ema := indicators.NewEMA(s.window)
+	for _, c := range state.Candles {
+		ema.Update(c.Close)
+	}
+	values := map[string]float64{"EMA": ema.Value()}
+
+	switch EntrySide(state.BidBest, state.AskBest, ema.Value(), s.deviation) {
+	case "buy":
+		return Signal{Action: Long, Reason: "price_below_ema_threshold", Values: values}
+	case "sell":
+		return Signal{Action: Short, Reason: "price_above_ema_threshold", Values: values}
+	}
+	return Signal{Reason: "within_ema_band", Values: values}
+}
+
+// bollingerBands replaces the fixed-percentage band with Bollinger Bands: long
+// at or below the lower band, short at or above the upper band. The "k" param
+// sets the band width in standard deviations (default 2).
+type bollingerBands struct {
+	window int
+	k      float64
+}
+
+func newBollingerBands(cfg StrategyConfig) (Strategy, error) {
+	if cfg.Window <= 1 {
+		return nil, fmt.Errorf("bollinger: window must be at least 2, got %d", cfg.Window)
+	}
+	k := cfg.Param("k", 2)
+	if k <= 0 {
+		return nil, fmt.Errorf("bollinger: k must be positive, got %v", k)
+	}
+	return &bollingerBands{window: cfg.Window, k: k}, nil
+}
+
+func (s *bollingerBands) Name() string { return "bollinger" }
+
+func (s *bollingerBands) Evaluate(state MarketState) Signal {
+	if len(state.Candles) < s.window {
+		return Signal{Reason: "not_enough_data"}
+	}
+	bb := indicators.NewBollinger(s.window, s.k)
+	for _, c := range state.Candles[len(state.Candles)-s.window:] {
+		bb.Update(c.Close)
+	}
+	bands := bb.Value()
+	values := map[string]float64{"BB_upper": bands.Upper, "BB_middle": bands.Middle, "BB_lower": bands.Lower}
+
+	switch {
+	case state.BidBest <= bands.Lower:
+		return Signal{Action: Long, Reason: "price_below_lower_band", Values: values}
+	case state.AskBest >= bands.Upper:
+		return Signal{Action: Short, Reason: "price_above_upper_band", Values: values}
+	}
+	return Signal{Reason: "within_bollinger_bands", Values: values}
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// TradeFlow sums the public trades of a recent window by aggressor side.
+// Volumes are in the base currency.
+type TradeFlow struct {
+	BuyVolume  float64 // bought by takers lifting asks
+	SellVolume float64 // sold by takers hitting bids
+	Count      int
+}
+
+// Imbalance is the net taker buy share of the volume, from -1 (all sells)
+// to 1 (all buys); 0 without trades.
+func (f TradeFlow) Imbalance() float64 {
+	total := f.BuyVolume + f.SellVolume
+	if total == 0 {
+		return 0
+	}
+	return (f.BuyVolume - f.SellVolume) / total
+}
+
+// tradeTape keeps the public trades that arrived within the last window.
+// Trades are timed by their arrival, so the window does not depend on the
+// exchange's clock agreeing with ours.
+type tradeTape struct {
+	mu     sync.Mutex
+	window time.Duration
+	trades []tapedTrade
+}
+
+// tapedTrade is a trade and when it arrived.
+type tapedTrade struct {
+	nobitex.Trade
+	arrived time.Time
+}
+
+// add records a trade arriving at now.
+func (t *tradeTape) add(trade nobitex.Trade, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trades = append(t.trades, tapedTrade{Trade: trade, arrived: now})
+	t.prune(now)
+}
+
+// flow sums the trades within the window before now.
+func (t *tradeTape) flow(now time.Time) TradeFlow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+	var f TradeFlow
+	for _, trade := range t.trades {
+		switch trade.Side {
+		case "buy":
+			f.BuyVolume += trade.Volume
+		case "sell":
+			f.SellVolume += trade.Volume
+		}
+		f.Count++
+	}
+	return f
+}
+
+func (t *tradeTape) prune(now time.Time) {
+	cutoff := now.Add(-t.window)
+	i := 0
+	for i < len(t.trades) && t.trades[i].arrived.Before(cutoff) {
+		i++
+	}
+	t.trades = append(t.trades[:0], t.trades[i:]...)
+}
+
+// fillHints watch the price of each side's resting entry order and flag it
+// when a public trade prints at or through it, so the entry loop checks the
+// order's status then instead of waiting to reprice.
+type fillHints struct {
+	mu     sync.Mutex
+	prices map[string]float64 // side -> resting order price
+	hit    map[string]bool
+}
+
+func newFillHints() *fillHints {
+	return &fillHints{prices: make(map[string]float64), hit: make(map[string]bool)}
+}
+
+// watch starts watching side's order resting at price.
+func (h *fillHints) watch(side string, price float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prices[side] = price
+	h.hit[side] = false
+}
+
+// clear stops watching side.
+func (h *fillHints) clear(side string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.prices, side)
+	delete(h.hit, side)
+}
+
+// observe flags the orders a trade may have filled: a resting buy when the
+// trade printed at or below it, a resting sell at or above it. It reports
+// whether it flagged either.
+func (h *fillHints) observe(trade nobitex.Trade) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	flagged := false
+	if price, ok := h.prices["buy"]; ok && trade.Price <= price {
+		h.hit["buy"] = true
+		flagged = true
+	}
+	if price, ok := h.prices["sell"]; ok && trade.Price >= price {
+		h.hit["sell"] = true
+		flagged = true
+	}
+	return flagged
+}
+
+// take reports and clears whether side's order was flagged.
+func (h *fillHints) take(side string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hit := h.hit[side]
+	h.hit[side] = false
+	return hit
+}
+
+// onTrade records a public trade on the tape and checks it against the
+// resting entry orders, waking their loops when it printed through one.
+func (bot *TradingBot) onTrade(trade nobitex.Trade) {
+	bot.tape.add(trade, time.Now())
+	if bot.fills.observe(trade) {
+		bot.entryWake.notify()
+	}
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+func TestTradeTapeUsesArrivalTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tape := tradeTape{window: time.Minute}
+
+	// The exchange's clock runs an hour behind ours; the trades still count.
+	skewed := now.Add(-time.Hour)
+	tape.add(nobitex.Trade{Time: skewed, Price: 100, Volume: 2, Side: "buy"}, now)
+	tape.add(nobitex.Trade{Time: skewed, Price: 100, Volume: 1, Side: "sell"}, now.Add(30*time.Second))
+
+	f := tape.flow(now.Add(45 * time.Second))
+	if f.Count != 2 || f.BuyVolume != 2 || f.SellVolume != 1 {
+		t.Fatalf("flow = %+v, want both trades", f)
+	}
+
+	f = tape.flow(now.Add(75 * time.Second))
+	if f.Count != 1 || f.BuyVolume != 0 || f.SellVolume != 1 {
+		t.Fatalf("flow = %+v, want only the trade that arrived within the window", f)
+	}
+}
+
+func TestFillHintsObserve(t *testing.T) {
+	h := newFillHints()
+	h.watch("buy", 100)
+	h.watch("sell", 110)
+
+	tests := []struct {
+		price   float64
+		flagged bool
+		buy     bool
+		sell    bool
+	}{
+		{105, false, false, false},
+		{100, true, true, false},
+		{111, true, false, true},
+	}
+	for _, tt := range tests {
+		if got := h.observe(nobitex.Trade{Price: tt.price}); got != tt.flagged {
+			t.Errorf("observe(%v) = %v, want %v", tt.price, got, tt.flagged)
+		}
+		if buy, sell := h.take("buy"), h.take("sell"); buy != tt.buy || sell != tt.sell {
+			t.Errorf("after a trade at %v: buy %v, sell %v; want %v, %v", tt.price, buy, sell, tt.buy, tt.sell)
+		}
+	}
+
+	h.clear("buy")
+	if h.observe(nobitex.Trade{Price: 90}) {
+		t.Error("cleared side still flagged")
+	}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// updateBestPrices records a new top of book against every position's exits.
+func (bot *TradingBot) updateBestPrices(bid, ask float64) {
+	bot.exitMu.Lock()
+	defer bot.exitMu.Unlock()
+	for _, exits := range bot.exits {
+		switch {
+		case exits.side == "buy" && bid > exits.best:
+			exits.best = bid
+		case exits.side == "sell" && ask > 0 && (ask < exits.best || exits.best == 0):
+			exits.best = ask
+		}
+	}
+}
+
+// trailStop ratchets the stop of a position's runner behind the best price
+// seen since entry. The runner's OCO is cancelled and re-placed with the same
+// take-profit once the stop would move by at least the configured minimum step.
+// If the new OCO can't be placed, coverExits places the runner again at the
+// new stop, so a failure never loosens it.
+func (bot *TradingBot) trailStop(ctx context.Context, pos nobitex.Position, exits *positionExits, bestBid, bestAsk float64) {
+	cfg := bot.cfg.Trailing
+	if !cfg.Enabled {
+		return
+	}
+
+	bot.exitMu.Lock()
+	var runner *exitLeg
+	for _, leg := range exits.legs {
+		if leg.runner {
+			runner = leg
+		}
+	}
+	best, atr, last := exits.best, bot.atr, exits.stop
+	bot.exitMu.Unlock()
+	if runner == nil {
+		return
+	}
+
+	stop := runner.stop
+	if stop == 0 {
+		stop = last
+	}
+	if stop == 0 {
+		// Adopted at startup without its prices; assume the configured distance.
+		_, stop = ExitPrices(exits.side, exits.entry, exits.entry, exits.entry, bot.cfg.Risk.ProfitTarget, bot.cfg.Risk.StopLoss)
+	}
+
+	distance := best * cfg.Distance
+	if cfg.Mode == "atr" {
+		if atr == 0 {
+			return
+		}
+		distance = atr * cfg.Distance
+	}
+	step := best * cfg.MinStep
+
+	var newStop float64
+	switch exits.side {
+	case "buy":
+		newStop = best - distance
+		if newStop < stop+step || newStop >= bestBid {
+			return
+		}
+	case "sell":
+		newStop = best + distance
+		if newStop > stop-step || newStop <= bestAsk {
+			return
+		}
+	default:
+		return
+	}
+
+	fields := logrus.Fields{
+		"position_id":  pos.ID,
+		"best_price":   best,
+		"old_stop":     stop,
+		"new_stop":     newStop,
+		"old_order_id": runner.orderID,
+	}
+	if err := bot.replaceExitLeg(ctx, pos, exits, runner, newStop); err != nil {
+		bot.closeLogger.WithFields(fields).WithError(err).Error("Failed to move trailing stop")
+		return
+	}
+	fields["order_id"] = runner.orderID
+	fields["take_profit"] = runner.takeProfit
+	bot.closeLogger.WithFields(fields).Info("Trailing stop moved")
+}
@@ -1,42 +1,59 @@
 package bot
 
 import (
+	"context"
 	"nobitex-sma-bot/internal/nobitex"
-	"strconv"
 	"time"
 )
 
-func (bot *TradingBot) calculateSMA(prices []float64) float64 {
-	var sum float64
-	for _, p := range prices {
-		sum += p
+// scaleCandles returns candles with prices multiplied by factor.
+func scaleCandles(candles []nobitex.Candle, factor float64) []nobitex.Candle {
+	scaled := make([]nobitex.Candle, len(candles))
+	for i, c := range candles {
+		c.Open *= factor
+		c.High *= factor
+		c.Low *= factor
+		c.Close *= factor
+		scaled[i] = c
 	}
-	return sum / float64(len(prices))
+	return scaled
 }
 
-func (bot *TradingBot) parseOrderBook(raw [][]string) [][2]float64 {
-	var result [][2]float64
-	for _, entry := range raw {
-		if len(entry) < 2 {
-			continue
-		}
-		price, err1 := strconv.ParseFloat(entry[0], 64)
-		amount, err2 := strconv.ParseFloat(entry[1], 64)
-		if err1 == nil && err2 == nil {
-			result = append(result, [2]float64{price, amount})
-		}
+// candleScale is the factor from candle prices to order book prices: toman
+// to rials on IRT pairs, none on pairs quoted in other currencies.
+func (bot *TradingBot) candleScale() float64 {
+	if bot.market().Rial() {
+		return rialCandleScale
 	}
-	return result
+	return 1
 }
 
-func (b *TradingBot) fetchOHLCVData() ([]float64, error) {
+// fetchOHLCVData fetches the last Window candles at the configured resolution.
+func (b *TradingBot) fetchOHLCVData(ctx context.Context) ([]nobitex.Candle, error) {
+	step, err := nobitex.ResolutionDuration(b.cfg.Strategy.Resolution)
+	if err != nil {
+		return nil, err
+	}
 	endTime := time.Now().Unix()
-	startTime := endTime - 60*Pastmin // e.g., fetch last 20 minutes of data
+	startTime := endTime - int64(step/time.Second)*int64(b.cfg.Strategy.Window)
 
-	return nobitex.GetOHLCVData(
+	return b.exchange.GetOHLCVData(
+		ctx,
 		b.currencyPair,
-		"1", // 1-minute resolution, or whichever you want
+		b.cfg.Strategy.Resolution,
 		startTime,
 		endTime,
 	)
 }
+
+// sleep pauses for d and reports whether it did so without ctx being cancelled.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -1,59 +1,219 @@
 package bot
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/centrifugal/centrifuge-go"
-	"strconv"
-	"strings"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
 )
 
-// WebSocketHandler connects to the Nobitex WS, subscribes to orderbook updates.
-func (bot *TradingBot) WebSocketHandler() {
-	url := "wss://wss.nobitex.ir/connection/websocket"
-	client := centrifuge.NewJsonClient(url, centrifuge.Config{})
-
-	client.OnConnected(func(_ centrifuge.ConnectedEvent) {
-		bot.openLogger.Info("Connected to WebSocket!")
-	})
-	client.OnDisconnected(func(e centrifuge.DisconnectedEvent) {
-		bot.openLogger.WithField("reason", e.Reason).
-			Warn("Disconnected from WebSocket")
-	})
-
-	channel := fmt.Sprintf("public:orderbook-%s", strings.ToUpper(bot.currencyPair))
-	sub, err := client.NewSubscription(channel)
-	if err != nil {
-		bot.openLogger.WithError(err).Fatal("Failed to create subscription")
-	}
-
-	sub.OnPublication(func(event centrifuge.PublicationEvent) {
-		if err := json.Unmarshal(event.Data, &bot.orderBook); err != nil {
-			bot.openLogger.WithError(err).Error("Error parsing orderBook data")
-			return
+// bookHealth tracks when order book snapshots arrive, to catch a stream that
+// stalled without disconnecting, or that delivers old snapshots or snapshots
+// out of order.
+type bookHealth struct {
+	mu        sync.Mutex
+	received  time.Time // when the last snapshot was applied, or the stream (re)started
+	updatedAt time.Time // exchange time of the last snapshot
+	stale     bool      // the watcher has reported the book stale
+	dropped   int       // snapshots dropped since the last one applied
+}
+
+// bookVerdict is what accept made of a snapshot.
+type bookVerdict int
+
+const (
+	bookApplied    bookVerdict = iota
+	bookOutOfOrder             // older than one already applied
+	bookTooOld                 // updated longer than maxAge before it arrived
+)
+
+// accept records a snapshot arriving at now. Snapshots older than one already
+// applied, or updated more than maxAge before now, are dropped and leave the
+// book to go stale. It also reports whether the book had been reported stale.
+func (h *bookHealth) accept(book nobitex.OrderBook, now time.Time, maxAge time.Duration) (verdict bookVerdict, wasStale bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !book.UpdatedAt.IsZero() {
+		switch {
+		case book.UpdatedAt.Before(h.updatedAt):
+			h.dropped++
+			return bookOutOfOrder, false
+		case now.Sub(book.UpdatedAt) > maxAge:
+			h.dropped++
+			return bookTooOld, false
 		}
-		parsedAsks := bot.parseOrderBook(bot.orderBook.Asks)
-		parsedBids := bot.parseOrderBook(bot.orderBook.Bids)
+		h.updatedAt = book.UpdatedAt
+	}
+	h.received = now
+	h.dropped = 0
+	wasStale = h.stale
+	h.stale = false
+	return bookApplied, wasStale
+}
+
+// restart gives a new subscription staleAfter to deliver its first snapshot.
+func (h *bookHealth) restart(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.received = now
+}
+
+// age is how long ago the last snapshot arrived.
+func (h *bookHealth) age(now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.Sub(h.received)
+}
+
+// markStale records that the book went stale. It reports whether the book was
+// fresh until now, and how many snapshots were dropped since the last one
+// applied.
+func (h *bookHealth) markStale() (first bool, dropped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	first = !h.stale
+	h.stale = true
+	return first, h.dropped
+}
+
+// reportedStale reports whether the book was marked stale and no snapshot
+// has been applied since, even if the stream was restarted.
+func (h *bookHealth) reportedStale() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stale
+}
+
+// bookStale reports whether no usable snapshot has arrived for
+// stream.stale_after, or since the book was reported stale. Entries, order
+// repricing, exit orders and the liquidation watch wait while it is.
+func (bot *TradingBot) bookStale() bool {
+	return bot.book.age(time.Now()) > bot.cfg.Stream.StaleAfter || bot.book.reportedStale()
+}
 
-		bot.bookMutex.Lock()
-		bot.orderBookGlobal.Asks = parsedAsks
-		bot.orderBookGlobal.Bids = parsedBids
-		bot.bookMutex.Unlock()
+// WebSocketHandler subscribes to order book updates for the bot's pair, and
+// to its trades and candles when configured, and starts a watcher that
+// reconnects whenever the book goes stale, until ctx is cancelled.
+func (bot *TradingBot) WebSocketHandler(ctx context.Context) {
+	bot.subscribeBook(ctx)
+	bot.wg.Add(1)
+	go bot.watchBook(ctx)
+}
+
+// subscribeBook closes the current market subscription, if any, and opens a
+// new one.
+func (bot *TradingBot) subscribeBook(ctx context.Context) {
+	bot.streamMu.Lock()
+	if bot.streamCancel != nil {
+		bot.streamCancel()
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	bot.streamCancel = cancel
+	bot.streamMu.Unlock()
+
+	bot.book.restart(time.Now())
+	handlers := nobitex.StreamHandlers{
+		OnConnected: func() {
+			bot.openLogger.Info("Connected to WebSocket!")
+		},
+		OnDisconnected: func(reason string) {
+			bot.openLogger.WithField("reason", reason).
+				Warn("Disconnected from WebSocket")
+		},
+		OnSubscribed: func(channel string, recovered bool) {
+			bot.openLogger.WithFields(logrus.Fields{"channel": channel, "recovered": recovered}).
+				Info("Subscribed to WebSocket channel")
+		},
+		OnError: func(err error) {
+			bot.openLogger.WithError(err).Error("WebSocket stream error")
+		},
+		OnOrderBook: bot.onOrderBook,
+	}
+	if bot.cfg.Stream.Trades {
+		handlers.OnTrade = bot.onTrade
+	}
+	if bot.cfg.Stream.Candles {
+		handlers.OnCandle = bot.onCandle
+		handlers.CandleResolution = bot.cfg.Strategy.Resolution
+	}
+	if err := bot.exchange.SubscribeMarket(streamCtx, bot.currencyPair, handlers); err != nil {
+		// The watcher retries once the book is stale.
+		bot.openLogger.WithError(err).Error("Failed to subscribe to order book")
+	}
+}
 
-		bot.priceMu.Lock()
-		if len(bot.orderBook.Asks) > 0 {
-			bot.askBest, _ = strconv.ParseFloat(bot.orderBook.Asks[0][0], 64)
+// watchBook checks the book's age and, while it is stale, resubscribes on a
+// fresh connection with exponential backoff. The backoff starts over once a
+// snapshot has been applied.
+func (bot *TradingBot) watchBook(ctx context.Context) {
+	defer bot.wg.Done()
+	cfg := bot.cfg.Stream
+	var (
+		attempt int
+		next    time.Time // earliest next reconnect
+	)
+	for sleep(ctx, cfg.StaleAfter/4) {
+		now := time.Now()
+		age := bot.book.age(now)
+		if age <= cfg.StaleAfter {
+			if !bot.book.reportedStale() {
+				attempt = 0
+			}
+			continue
 		}
-		if len(bot.orderBook.Bids) > 0 {
-			bot.bidBest, _ = strconv.ParseFloat(bot.orderBook.Bids[0][0], 64)
+		if first, dropped := bot.book.markStale(); first {
+			bot.openLogger.WithFields(logrus.Fields{"age": age.Round(time.Second).String(), "dropped": dropped}).
+				Warn("Order book is stale: entries, repricing and exits paused")
 		}
-		bot.priceMu.Unlock()
-	})
+		if now.Before(next) {
+			continue
+		}
+		attempt++
+		delay := min(cfg.ReconnectMin<<min(attempt-1, 16), cfg.ReconnectMax)
+		next = now.Add(delay)
+		bot.openLogger.WithFields(logrus.Fields{"attempt": attempt, "next_retry": delay.String()}).
+			Warn("Reconnecting to WebSocket")
+		bot.subscribeBook(ctx)
+	}
+}
 
-	if err := sub.Subscribe(); err != nil {
-		bot.openLogger.WithError(err).Fatal("Failed to subscribe to WS channel")
+// onOrderBook stores the latest book and refreshes the best bid/ask, waking
+// the entry loops, and the main loop when either moved. Snapshots older than
+// the current book, or than stream.stale_after, are dropped.
+func (bot *TradingBot) onOrderBook(book nobitex.OrderBook) {
+	verdict, wasStale := bot.book.accept(book, time.Now(), bot.cfg.Stream.StaleAfter)
+	switch verdict {
+	case bookOutOfOrder:
+		bot.openLogger.WithField("updated_at", book.UpdatedAt).Debug("Dropped out-of-order order book snapshot")
+		return
+	case bookTooOld:
+		bot.openLogger.WithField("updated_at", book.UpdatedAt).Debug("Dropped old order book snapshot")
+		return
 	}
-	if err := client.Connect(); err != nil {
-		bot.openLogger.WithError(err).Fatal("Failed to connect to WS")
+	if wasStale {
+		bot.openLogger.Info("Order book is fresh again: entries, repricing and exits resumed")
+	}
+
+	bot.bookMutex.Lock()
+	bot.orderBookGlobal = book
+	bot.bookMutex.Unlock()
+
+	bot.priceMu.Lock()
+	prevBid, prevAsk := bot.bidBest, bot.askBest
+	if len(book.Asks) > 0 {
+		bot.askBest = book.Asks[0][0]
+	}
+	if len(book.Bids) > 0 {
+		bot.bidBest = book.Bids[0][0]
+	}
+	bid, ask := bot.bidBest, bot.askBest
+	bot.priceMu.Unlock()
+
+	bot.updateBestPrices(bid, ask)
+	bot.entryWake.notify()
+	if bid != prevBid || ask != prevAsk {
+		bot.events.notify(bookEvent)
 	}
 }
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+func TestBookHealthAccept(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const maxAge = time.Minute
+	book := func(updated time.Time) nobitex.OrderBook { return nobitex.OrderBook{UpdatedAt: updated} }
+
+	tests := []struct {
+		name    string
+		updated time.Time
+		now     time.Time
+		want    bookVerdict
+	}{
+		{"first snapshot", base, base.Add(time.Second), bookApplied},
+		{"newer snapshot", base.Add(2 * time.Second), base.Add(3 * time.Second), bookApplied},
+		{"same time again", base.Add(2 * time.Second), base.Add(4 * time.Second), bookApplied},
+		{"out of order", base.Add(time.Second), base.Add(5 * time.Second), bookOutOfOrder},
+		{"no exchange time", time.Time{}, base.Add(6 * time.Second), bookApplied},
+		{"older than max age", base.Add(3 * time.Second), base.Add(3*time.Second + maxAge + time.Millisecond), bookTooOld},
+		{"exactly max age", base.Add(4 * time.Second), base.Add(4*time.Second + maxAge), bookApplied},
+	}
+
+	var h bookHealth
+	for _, tt := range tests {
+		verdict, _ := h.accept(book(tt.updated), tt.now, maxAge)
+		if verdict != tt.want {
+			t.Errorf("%s: verdict = %v, want %v", tt.name, verdict, tt.want)
+		}
+		if verdict == bookApplied && h.age(tt.now) != 0 {
+			t.Errorf("%s: age = %v after an applied snapshot, want 0", tt.name, h.age(tt.now))
+		}
+	}
+}
+
+func TestBookHealthStale(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var h bookHealth
+	h.restart(base)
+
+	if got := h.age(base.Add(90 * time.Second)); got != 90*time.Second {
+		t.Fatalf("age = %v, want 90s", got)
+	}
+
+	// Dropped snapshots don't refresh the book.
+	h.accept(nobitex.OrderBook{UpdatedAt: base.Add(-2 * time.Minute)}, base.Add(10*time.Second), time.Minute)
+	h.accept(nobitex.OrderBook{UpdatedAt: base.Add(-3 * time.Minute)}, base.Add(20*time.Second), time.Minute)
+	if got := h.age(base.Add(30 * time.Second)); got != 30*time.Second {
+		t.Fatalf("age after dropped snapshots = %v, want 30s", got)
+	}
+
+	first, dropped := h.markStale()
+	if !first || dropped != 2 {
+		t.Fatalf("markStale = %v, %d; want true, 2", first, dropped)
+	}
+	if first, _ := h.markStale(); first {
+		t.Fatal("second markStale reported the book fresh until now")
+	}
+
+	verdict, wasStale := h.accept(nobitex.OrderBook{UpdatedAt: base.Add(40 * time.Second)}, base.Add(41*time.Second), time.Minute)
+	if verdict != bookApplied || !wasStale {
+		t.Fatalf("accept after stale = %v, %v; want applied, true", verdict, wasStale)
+	}
+	if first, dropped := h.markStale(); !first || dropped != 0 {
+		t.Fatalf("markStale after a fresh snapshot = %v, %d; want true, 0", first, dropped)
+	}
+}
+
+// silentExchange accepts market subscriptions but never publishes, and
+// records when each one was opened.
+type silentExchange struct {
+	Exchange
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (e *silentExchange) SubscribeMarket(ctx context.Context, currencyPair string, handlers nobitex.StreamHandlers) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, time.Now())
+	return nil
+}
+
+func (e *silentExchange) subscriptions() []time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]time.Time(nil), e.calls...)
+}
+
+func TestWatchBookBackoff(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	exchange := &silentExchange{}
+	cfg := DefaultConfig()
+	cfg.Stream.StaleAfter = 20 * time.Millisecond
+	cfg.Stream.ReconnectMin = 50 * time.Millisecond
+	cfg.Stream.ReconnectMax = 200 * time.Millisecond
+	bot := &TradingBot{
+		currencyPair: "BTCIRT",
+		exchange:     exchange,
+		cfg:          cfg,
+		openLogger:   logger,
+		closeLogger:  logger,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+	defer cancel()
+	bot.book.restart(time.Now())
+	bot.wg.Add(1)
+	go bot.watchBook(ctx)
+	bot.wg.Wait()
+
+	calls := exchange.subscriptions()
+	// Stale after ~25ms, then reconnects 50, 100, 200 and 200ms apart.
+	if len(calls) < 3 || len(calls) > 5 {
+		t.Fatalf("reconnected %d times in 700ms, want 3 to 5", len(calls))
+	}
+	want := []time.Duration{50, 100, 200, 200}
+	for i := 1; i < len(calls); i++ {
+		gap := calls[i].Sub(calls[i-1])
+		if min := want[i-1] * time.Millisecond; gap < min-2*time.Millisecond {
+			t.Errorf("reconnect %d came %v after the previous one, want at least %v", i+1, gap, min)
+		}
+	}
+	if !bot.bookStale() {
+		t.Error("book not stale after a silent stream")
+	}
+}
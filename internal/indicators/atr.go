@@ -0,0 +1,36 @@
+package indicators
+
+import "math"
+
+// ATR is Wilder's average true range over period candles.
+type ATR struct {
+	period    int
+	count     int
+	prevClose float64
+	value     float64
+}
+
+func NewATR(period int) *ATR {
+	checkPeriod(period)
+	return &ATR{period: period}
+}
+
+func (a *ATR) Update(high, low, close float64) float64 {
+	tr := high - low
+	if a.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(high-a.prevClose), math.Abs(low-a.prevClose)))
+	}
+	a.prevClose = close
+	a.count++
+
+	if a.count <= a.period {
+		a.value += (tr - a.value) / float64(a.count)
+	} else {
+		a.value = (a.value*float64(a.period-1) + tr) / float64(a.period)
+	}
+	return a.value
+}
+
+func (a *ATR) Value() float64 { return a.value }
+
+func (a *ATR) Ready() bool { return a.count >= a.period }
@@ -0,0 +1,58 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func TestATR(t *testing.T) {
+	a := NewATR(3)
+	candles := []struct{ high, low, close float64 }{
+		{10, 8, 9},   // TR 2
+		{11, 9, 10},  // TR 2
+		{15, 10, 14}, // TR 5
+		{14, 12, 13}, // TR 2
+		{13, 7, 8},   // TR 6
+	}
+	// The first three TRs are averaged, then Wilder smoothing: (3*2+2)/3, ...
+	want := []float64{2, 2, 3, 8.0 / 3, (16.0/3 + 6) / 3}
+	for i, c := range candles {
+		if got := a.Update(c.high, c.low, c.close); !near(got, want[i]) {
+			t.Fatalf("update %d: got %v, want %v", i, got, want[i])
+		}
+		if a.Ready() != (i >= 2) {
+			t.Fatalf("update %d: Ready = %v", i, a.Ready())
+		}
+	}
+}
+
+func TestATRMatchesRecomputation(t *testing.T) {
+	prices := walk(300)
+	const period = 14
+	highs, lows := make([]float64, len(prices)), make([]float64, len(prices))
+	for i, p := range prices {
+		highs[i], lows[i] = p+1+math.Abs(math.Sin(float64(i))), p-1
+	}
+
+	a := NewATR(period)
+	for i := range prices {
+		got := a.Update(highs[i], lows[i], prices[i])
+
+		// Wilder's ATR over the whole history so far.
+		var want float64
+		for j := 0; j <= i; j++ {
+			tr := highs[j] - lows[j]
+			if j > 0 {
+				tr = math.Max(tr, math.Max(math.Abs(highs[j]-prices[j-1]), math.Abs(lows[j]-prices[j-1])))
+			}
+			if j < period {
+				want += (tr - want) / float64(j+1)
+			} else {
+				want = (want*(period-1) + tr) / period
+			}
+		}
+		if !near(got, want) {
+			t.Fatalf("update %d: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package indicators
+
+// SMA is a simple moving average over the last period values.
+type SMA struct {
+	window *ring
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	checkPeriod(period)
+	return &SMA{window: newRing(period)}
+}
+
+func (s *SMA) Update(v float64) float64 {
+	if old, full := s.window.push(v); full {
+		s.sum -= old
+	}
+	s.sum += v
+	return s.Value()
+}
+
+func (s *SMA) Value() float64 {
+	if s.window.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.window.count)
+}
+
+func (s *SMA) Ready() bool { return s.window.full() }
+
+// EMA is an exponential moving average with smoothing 2/(period+1), seeded
+// with the simple average of the first period values.
+type EMA struct {
+	period int
+	alpha  float64
+	value  float64
+	count  int
+}
+
+func NewEMA(period int) *EMA {
+	checkPeriod(period)
+	return &EMA{period: period, alpha: 2 / float64(period+1)}
+}
+
+func (e *EMA) Update(v float64) float64 {
+	e.count++
+	if e.count <= e.period {
+		e.value += (v - e.value) / float64(e.count)
+	} else {
+		e.value += e.alpha * (v - e.value)
+	}
+	return e.value
+}
+
+func (e *EMA) Value() float64 { return e.value }
+
+func (e *EMA) Ready() bool { return e.count >= e.period }
+
+// WMA is a linearly weighted moving average: the newest value has weight
+// period, the oldest weight 1.
+type WMA struct {
+	window   *ring
+	sum      float64
+	weighted float64
+}
+
+func NewWMA(period int) *WMA {
+	checkPeriod(period)
+	return &WMA{window: newRing(period)}
+}
+
+func (w *WMA) Update(v float64) float64 {
+	if !w.window.full() {
+		w.window.push(v)
+		w.sum += v
+		w.weighted += float64(w.window.count) * v
+		return w.Value()
+	}
+	old, _ := w.window.push(v)
+	// Every existing value loses one unit of weight and v enters at full weight.
+	w.weighted += float64(w.window.count)*v - w.sum
+	w.sum += v - old
+	return w.Value()
+}
+
+func (w *WMA) Value() float64 {
+	n := float64(w.window.count)
+	if n == 0 {
+		return 0
+	}
+	return w.weighted / (n * (n + 1) / 2)
+}
+
+func (w *WMA) Ready() bool { return w.window.full() }
+
+// VWAP is the volume-weighted average price. With period 0 it accumulates
+// until Reset (for session VWAP); otherwise it covers the last period updates.
+type VWAP struct {
+	prices  *ring
+	volumes *ring
+	pv      float64
+	volume  float64
+}
+
+func NewVWAP(period int) *VWAP {
+	if period < 0 {
+		panic("indicators: period must not be negative")
+	}
+	v := &VWAP{}
+	if period > 0 {
+		v.prices, v.volumes = newRing(period), newRing(period)
+	}
+	return v
+}
+
+// Update adds a trade or candle; pass the typical price (h+l+c)/3 for candles.
+func (v *VWAP) Update(price, volume float64) float64 {
+	if v.prices != nil {
+		oldPV, full := v.prices.push(price * volume)
+		oldVolume, _ := v.volumes.push(volume)
+		if full {
+			v.pv -= oldPV
+			v.volume -= oldVolume
+		}
+	}
+	v.pv += price * volume
+	v.volume += volume
+	return v.Value()
+}
+
+func (v *VWAP) Value() float64 {
+	if v.volume == 0 {
+		return 0
+	}
+	return v.pv / v.volume
+}
+
+func (v *VWAP) Ready() bool {
+	if v.prices != nil {
+		return v.prices.full() && v.volume > 0
+	}
+	return v.volume > 0
+}
+
+// Reset starts a new session.
+func (v *VWAP) Reset() {
+	prices, volumes := v.prices, v.volumes
+	*v = VWAP{}
+	if prices != nil {
+		v.prices, v.volumes = newRing(len(prices.values)), newRing(len(volumes.values))
+	}
+}
@@ -0,0 +1,90 @@
+package indicators
+
+import "testing"
+
+func TestSMA(t *testing.T) {
+	prices := walk(200)
+	const period = 10
+	s := NewSMA(period)
+	for i, p := range prices {
+		got := s.Update(p)
+		lo := max(0, i+1-period)
+		want := 0.0
+		for _, v := range prices[lo : i+1] {
+			want += v
+		}
+		want /= float64(i + 1 - lo)
+		if !near(got, want) {
+			t.Fatalf("update %d: got %v, want %v", i, got, want)
+		}
+		if s.Ready() != (i+1 >= period) {
+			t.Fatalf("update %d: Ready = %v", i, s.Ready())
+		}
+	}
+	if NewSMA(3).Value() != 0 {
+		t.Error("empty SMA is not 0")
+	}
+}
+
+func TestEMA(t *testing.T) {
+	e := NewEMA(3)
+	// Seeded with the average of the first three, then alpha 0.5.
+	for i, tt := range []struct{ in, want float64 }{
+		{2, 2}, {4, 3}, {6, 4}, {10, 7}, {7, 7}, {3, 5},
+	} {
+		if got := e.Update(tt.in); !near(got, tt.want) {
+			t.Fatalf("update %d: got %v, want %v", i, got, tt.want)
+		}
+		if e.Ready() != (i >= 2) {
+			t.Fatalf("update %d: Ready = %v", i, e.Ready())
+		}
+	}
+}
+
+func TestWMA(t *testing.T) {
+	prices := walk(200)
+	const period = 7
+	w := NewWMA(period)
+	for i, p := range prices {
+		got := w.Update(p)
+		lo := max(0, i+1-period)
+		var sum, weights float64
+		for j, v := range prices[lo : i+1] {
+			sum += float64(j+1) * v
+			weights += float64(j + 1)
+		}
+		if want := sum / weights; !near(got, want) {
+			t.Fatalf("update %d: got %v, want %v", i, got, want)
+		}
+	}
+	if !w.Ready() {
+		t.Error("WMA not ready")
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	session := NewVWAP(0)
+	session.Update(10, 1)
+	session.Update(20, 3)
+	if got := session.Value(); !near(got, 17.5) {
+		t.Fatalf("session VWAP = %v, want 17.5", got)
+	}
+	session.Reset()
+	if session.Ready() || session.Value() != 0 {
+		t.Fatal("VWAP not empty after Reset")
+	}
+
+	rolling := NewVWAP(2)
+	rolling.Update(10, 1)
+	if rolling.Ready() {
+		t.Fatal("rolling VWAP ready before its window filled")
+	}
+	rolling.Update(20, 1)
+	if got := rolling.Update(40, 3); !near(got, 35) {
+		t.Fatalf("rolling VWAP = %v, want 35", got)
+	}
+	rolling.Reset()
+	if got := rolling.Update(8, 2); !near(got, 8) || rolling.Ready() {
+		t.Fatalf("rolling VWAP after Reset = %v, ready %v", got, rolling.Ready())
+	}
+}
@@ -0,0 +1,97 @@
+package indicators
+
+import "math"
+
+// Bands is an upper/middle/lower channel.
+type Bands struct {
+	Upper  float64
+	Middle float64
+	Lower  float64
+}
+
+// Bollinger is an SMA with bands k population standard deviations away.
+type Bollinger struct {
+	k      float64
+	window *ring
+	sum    float64
+	sumSq  float64
+}
+
+func NewBollinger(period int, k float64) *Bollinger {
+	checkPeriod(period)
+	return &Bollinger{k: k, window: newRing(period)}
+}
+
+func (b *Bollinger) Update(v float64) Bands {
+	if old, full := b.window.push(v); full {
+		b.sum -= old
+		b.sumSq -= old * old
+	}
+	b.sum += v
+	b.sumSq += v * v
+	return b.Value()
+}
+
+func (b *Bollinger) Value() Bands {
+	n := float64(b.window.count)
+	if n == 0 {
+		return Bands{}
+	}
+	mean := b.sum / n
+	// Clamp tiny negative variances left by floating-point cancellation.
+	std := math.Sqrt(math.Max(b.sumSq/n-mean*mean, 0))
+	return Bands{Upper: mean + b.k*std, Middle: mean, Lower: mean - b.k*std}
+}
+
+func (b *Bollinger) Ready() bool { return b.window.full() }
+
+// Donchian tracks the highest high and lowest low of the last period candles
+// with monotonic queues, so each update is amortized O(1).
+type Donchian struct {
+	period int
+	count  int
+	highs  []indexed
+	lows   []indexed
+}
+
+type indexed struct {
+	index int
+	value float64
+}
+
+func NewDonchian(period int) *Donchian {
+	checkPeriod(period)
+	return &Donchian{period: period}
+}
+
+func (d *Donchian) Update(high, low float64) Bands {
+	i := d.count
+	d.count++
+
+	for len(d.highs) > 0 && d.highs[len(d.highs)-1].value <= high {
+		d.highs = d.highs[:len(d.highs)-1]
+	}
+	d.highs = append(d.highs, indexed{i, high})
+	for len(d.lows) > 0 && d.lows[len(d.lows)-1].value >= low {
+		d.lows = d.lows[:len(d.lows)-1]
+	}
+	d.lows = append(d.lows, indexed{i, low})
+
+	for d.highs[0].index <= i-d.period {
+		d.highs = d.highs[1:]
+	}
+	for d.lows[0].index <= i-d.period {
+		d.lows = d.lows[1:]
+	}
+	return d.Value()
+}
+
+func (d *Donchian) Value() Bands {
+	if d.count == 0 {
+		return Bands{}
+	}
+	upper, lower := d.highs[0].value, d.lows[0].value
+	return Bands{Upper: upper, Middle: (upper + lower) / 2, Lower: lower}
+}
+
+func (d *Donchian) Ready() bool { return d.count >= d.period }
@@ -0,0 +1,55 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBollinger(t *testing.T) {
+	prices := walk(200)
+	const period, k = 20, 2.0
+	b := NewBollinger(period, k)
+	for i, p := range prices {
+		got := b.Update(p)
+		window := prices[max(0, i+1-period) : i+1]
+		var mean, variance float64
+		for _, v := range window {
+			mean += v
+		}
+		mean /= float64(len(window))
+		for _, v := range window {
+			variance += (v - mean) * (v - mean)
+		}
+		std := math.Sqrt(variance / float64(len(window)))
+		if !near(got.Middle, mean) || math.Abs(got.Upper-(mean+k*std)) > 1e-6 || math.Abs(got.Lower-(mean-k*std)) > 1e-6 {
+			t.Fatalf("update %d: got %+v, want middle %v std %v", i, got, mean, std)
+		}
+	}
+
+	flat := NewBollinger(3, 2)
+	for range 5 {
+		flat.Update(1e6 + 0.1)
+	}
+	if got := flat.Value(); got.Upper < got.Middle || got.Lower > got.Middle {
+		t.Errorf("flat series bands crossed: %+v", got)
+	}
+}
+
+func TestDonchian(t *testing.T) {
+	prices := walk(300)
+	const period = 15
+	d := NewDonchian(period)
+	for i, p := range prices {
+		got := d.Update(p+0.5, p-0.5)
+		upper, lower := math.Inf(-1), math.Inf(1)
+		for _, v := range prices[max(0, i+1-period) : i+1] {
+			upper, lower = math.Max(upper, v+0.5), math.Min(lower, v-0.5)
+		}
+		if got.Upper != upper || got.Lower != lower || !near(got.Middle, (upper+lower)/2) {
+			t.Fatalf("update %d: got %+v, want %v..%v", i, got, lower, upper)
+		}
+		if d.Ready() != (i+1 >= period) {
+			t.Fatalf("update %d: Ready = %v", i, d.Ready())
+		}
+	}
+}
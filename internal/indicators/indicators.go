@@ -0,0 +1,36 @@
+// Package indicators implements streaming technical indicators. Each indicator
+// is fed one observation at a time with Update and keeps only the state it
+// needs, so it can follow a live candle series without recomputing history.
+// Ready reports whether enough observations have been seen for Value to be
+// meaningful.
+package indicators
+
+// ring is a fixed-size window over the most recent values.
+type ring struct {
+	values []float64
+	next   int
+	count  int
+}
+
+func newRing(size int) *ring {
+	return &ring{values: make([]float64, size)}
+}
+
+// push adds v and returns the value it evicted, if the window was full.
+func (r *ring) push(v float64) (float64, bool) {
+	old, full := r.values[r.next], r.count == len(r.values)
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if !full {
+		r.count++
+	}
+	return old, full
+}
+
+func (r *ring) full() bool { return r.count == len(r.values) }
+
+func checkPeriod(period int) {
+	if period <= 0 {
+		panic("indicators: period must be positive")
+	}
+}
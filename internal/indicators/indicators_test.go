@@ -0,0 +1,52 @@
+package indicators
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const epsilon = 1e-9
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= epsilon*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// walk is a reproducible random walk of n prices around 100.
+func walk(n int) []float64 {
+	rng := rand.New(rand.NewSource(42))
+	prices := make([]float64, n)
+	p := 100.0
+	for i := range prices {
+		p += rng.NormFloat64()
+		prices[i] = p
+	}
+	return prices
+}
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	for i, v := range []float64{1, 2, 3} {
+		if _, full := r.push(v); full {
+			t.Fatalf("push %d evicted from a window that was not full", i)
+		}
+	}
+	if !r.full() {
+		t.Fatal("ring not full after 3 pushes")
+	}
+	for _, want := range []float64{1, 2, 3, 4} {
+		old, full := r.push(want + 3)
+		if !full || old != want {
+			t.Fatalf("push evicted %v, %v; want %v, true", old, full, want)
+		}
+	}
+}
+
+func TestCheckPeriod(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic for period 0")
+		}
+	}()
+	NewSMA(0)
+}
@@ -0,0 +1,90 @@
+package indicators
+
+// RSI is Wilder's relative strength index over period closes.
+type RSI struct {
+	period  int
+	count   int
+	prev    float64
+	avgGain float64
+	avgLoss float64
+}
+
+func NewRSI(period int) *RSI {
+	checkPeriod(period)
+	return &RSI{period: period}
+}
+
+func (r *RSI) Update(close float64) float64 {
+	r.count++
+	if r.count == 1 {
+		r.prev = close
+		return r.Value()
+	}
+	change := close - r.prev
+	r.prev = close
+	gain, loss := max(change, 0), max(-change, 0)
+
+	// The first period changes are averaged, then Wilder smoothing takes over.
+	n := float64(r.period)
+	if r.count <= r.period+1 {
+		k := float64(r.count - 1)
+		r.avgGain += (gain - r.avgGain) / k
+		r.avgLoss += (loss - r.avgLoss) / k
+	} else {
+		r.avgGain = (r.avgGain*(n-1) + gain) / n
+		r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+	}
+	return r.Value()
+}
+
+func (r *RSI) Value() float64 {
+	if r.count < 2 {
+		return 50
+	}
+	if r.avgLoss == 0 {
+		if r.avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.avgGain/r.avgLoss)
+}
+
+func (r *RSI) Ready() bool { return r.count > r.period }
+
+// MACDValue is the MACD line, its signal line and their difference.
+type MACDValue struct {
+	MACD      float64
+	Signal    float64
+	Histogram float64
+}
+
+// MACD is the difference of a fast and a slow EMA, with an EMA signal line.
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	if fast >= slow {
+		panic("indicators: MACD fast period must be shorter than slow")
+	}
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (m *MACD) Update(close float64) MACDValue {
+	m.fast.Update(close)
+	m.slow.Update(close)
+	if m.slow.Ready() {
+		m.signal.Update(m.fast.Value() - m.slow.Value())
+	}
+	return m.Value()
+}
+
+func (m *MACD) Value() MACDValue {
+	line := m.fast.Value() - m.slow.Value()
+	return MACDValue{MACD: line, Signal: m.signal.Value(), Histogram: line - m.signal.Value()}
+}
+
+func (m *MACD) Ready() bool { return m.signal.Ready() }
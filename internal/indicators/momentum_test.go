@@ -0,0 +1,68 @@
+package indicators
+
+import "testing"
+
+func TestRSI(t *testing.T) {
+	r := NewRSI(2)
+	if got := r.Update(10); got != 50 {
+		t.Fatalf("first update = %v, want 50", got)
+	}
+	// Changes +2, -1: average gain 1, loss 0.5, RSI 100-100/3.
+	r.Update(12)
+	if got := r.Update(11); !near(got, 100-100.0/3) {
+		t.Fatalf("got %v, want %v", got, 100-100.0/3)
+	}
+	if !r.Ready() {
+		t.Fatal("RSI not ready after period changes")
+	}
+	// Wilder smoothing: gain (1+3)/2 = 2, loss 0.5/2 = 0.25.
+	if got := r.Update(14); !near(got, 100-100/(1+8.0)) {
+		t.Fatalf("got %v, want %v", got, 100-100/(1+8.0))
+	}
+
+	up := NewRSI(3)
+	for _, p := range []float64{1, 2, 3, 4} {
+		up.Update(p)
+	}
+	if up.Value() != 100 {
+		t.Errorf("rising series RSI = %v, want 100", up.Value())
+	}
+	flat := NewRSI(3)
+	for range 4 {
+		flat.Update(5)
+	}
+	if flat.Value() != 50 {
+		t.Errorf("flat series RSI = %v, want 50", flat.Value())
+	}
+}
+
+func TestMACD(t *testing.T) {
+	prices := walk(100)
+	m := NewMACD(3, 6, 4)
+	fast, slow, signal := NewEMA(3), NewEMA(6), NewEMA(4)
+	for i, p := range prices {
+		got := m.Update(p)
+		fast.Update(p)
+		slow.Update(p)
+		if slow.Ready() {
+			signal.Update(fast.Value() - slow.Value())
+		}
+		line := fast.Value() - slow.Value()
+		if !near(got.MACD, line) || !near(got.Signal, signal.Value()) || !near(got.Histogram, line-signal.Value()) {
+			t.Fatalf("update %d: got %+v", i, got)
+		}
+		// The signal line needs 4 values after the slow EMA's 6.
+		if m.Ready() != (i >= 8) {
+			t.Fatalf("update %d: Ready = %v", i, m.Ready())
+		}
+	}
+}
+
+func TestMACDPeriods(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic for fast >= slow")
+		}
+	}()
+	NewMACD(6, 6, 3)
+}
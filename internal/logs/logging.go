@@ -35,3 +35,16 @@ func Filelogger(dirPath, fileName string, level logrus.Level) (*logrus.Logger, e
 
 	return logger, nil
 }
+
+// Close flushes and closes the file behind a logger created by Filelogger.
+func Close(logger *logrus.Logger) error {
+	file, ok := logger.Out.(*os.File)
+	if !ok {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
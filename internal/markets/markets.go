@@ -0,0 +1,180 @@
+// Package markets caches the trading rules of Nobitex markets (price tick,
+// amount step, minimum order value and margin leverage) and rounds orders to
+// them.
+package markets
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// Source fetches the rules of every market; *nobitex.Client implements it.
+type Source interface {
+	GetMarkets(ctx context.Context) (map[string]nobitex.MarketInfo, error)
+}
+
+// Rules are the trading rules of one market.
+type Rules nobitex.MarketInfo
+
+// Default returns the rules assumed for symbol until the exchange's are known:
+// currencies parsed from the symbol, whole-unit prices, eight-decimal amounts
+// and, for rial markets, the 100,000 rial minimum order.
+func Default(symbol string) Rules {
+	r := Rules{
+		Symbol:        strings.ToUpper(symbol),
+		PriceTick:     1,
+		AmountStep:    1e-8,
+		MaxLeverage:   5,
+		MarginEnabled: true,
+	}
+	if m, err := nobitex.ParseMarket(r.Symbol); err == nil {
+		r.Src, r.Dst = m.Src, m.Dst
+	}
+	if r.Dst == "rls" {
+		r.MinOrderValue = 100000
+	}
+	return r
+}
+
+// Registry caches the rules of every market, refreshing them from a Source at
+// most once per TTL. It is safe for concurrent use.
+type Registry struct {
+	source Source
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	rules     map[string]Rules
+	nextFetch time.Time
+}
+
+// retryDelay spaces out fetches after a failed one.
+const retryDelay = time.Minute
+
+// NewRegistry returns an empty registry; call Refresh to load the rules.
+func NewRegistry(source Source, ttl time.Duration) *Registry {
+	return &Registry{source: source, ttl: ttl, rules: make(map[string]Rules)}
+}
+
+// Refresh fetches the rules again if they are older than the TTL. On error
+// the rules already cached are kept and the fetch is retried a minute later.
+func (r *Registry) Refresh(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Now().Before(r.nextFetch) {
+		return nil
+	}
+	markets, err := r.source.GetMarkets(ctx)
+	if err != nil {
+		r.nextFetch = time.Now().Add(min(retryDelay, r.ttl))
+		return err
+	}
+	for symbol, m := range markets {
+		r.rules[symbol] = Rules(m)
+	}
+	r.nextFetch = time.Now().Add(r.ttl)
+	return nil
+}
+
+// Rules returns the cached rules of symbol, with Default filling in anything
+// the exchange did not report.
+func (r *Registry) Rules(symbol string) Rules {
+	symbol = strings.ToUpper(symbol)
+	rules := Default(symbol)
+
+	r.mu.Lock()
+	cached, ok := r.rules[symbol]
+	r.mu.Unlock()
+	if !ok {
+		return rules
+	}
+	if cached.Src != "" && cached.Dst != "" {
+		rules.Src, rules.Dst = cached.Src, cached.Dst
+	}
+	if cached.PriceTick > 0 {
+		rules.PriceTick = cached.PriceTick
+	}
+	if cached.AmountStep > 0 {
+		rules.AmountStep = cached.AmountStep
+	}
+	if cached.MinOrderValue > 0 {
+		rules.MinOrderValue = cached.MinOrderValue
+	}
+	if cached.MaxLeverage > 0 || !cached.MarginEnabled {
+		rules.MaxLeverage = cached.MaxLeverage
+		rules.MarginEnabled = cached.MarginEnabled
+	}
+	return rules
+}
+
+// Loaded reports whether the exchange's rules for symbol have been fetched.
+func (r *Registry) Loaded(symbol string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.rules[strings.ToUpper(symbol)]
+	return ok
+}
+
+// Market returns symbol's currencies as the margin markets list names them,
+// falling back to parsing the symbol until the list has been fetched.
+func (r *Registry) Market(symbol string) nobitex.Market {
+	rules := r.Rules(symbol)
+	return nobitex.Market{Symbol: rules.Symbol, Src: rules.Src, Dst: rules.Dst}
+}
+
+// RoundAmount rounds an order amount down to the amount step.
+func (r Rules) RoundAmount(amount float64) float64 {
+	return roundTo(amount, r.AmountStep, math.Floor)
+}
+
+// Placeable reports whether an order of amount, already rounded, at price
+// meets the market's minimums: at least one amount step and the minimum
+// order value.
+func (r Rules) Placeable(amount, price float64) bool {
+	return amount > 0 && amount*price >= r.MinOrderValue
+}
+
+// RoundPrice rounds a price to the nearest tick.
+func (r Rules) RoundPrice(price float64) float64 {
+	return roundTo(price, r.PriceTick, math.Round)
+}
+
+// RoundPriceDown and RoundPriceUp round a price to a tick in one direction,
+// for orders that must not cross a level.
+func (r Rules) RoundPriceDown(price float64) float64 {
+	return roundTo(price, r.PriceTick, math.Floor)
+}
+
+func (r Rules) RoundPriceUp(price float64) float64 {
+	return roundTo(price, r.PriceTick, math.Ceil)
+}
+
+// roundTo rounds x to a multiple of step with fn, then trims the float error
+// so the result formats with no more decimals than step has.
+func roundTo(x, step float64, fn func(float64) float64) float64 {
+	if step <= 0 {
+		return x
+	}
+	// The epsilon keeps values already on a step from moving by one.
+	n := x / step
+	switch {
+	case n-math.Floor(n) < 1e-9:
+		n = math.Floor(n)
+	case math.Ceil(n)-n < 1e-9:
+		n = math.Ceil(n)
+	default:
+		n = fn(n)
+	}
+	rounded := n * step
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step) - 1e-9))
+	}
+	clean, _ := strconv.ParseFloat(strconv.FormatFloat(rounded, 'f', decimals, 64), 64)
+	return clean
+}
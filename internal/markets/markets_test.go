@@ -0,0 +1,27 @@
+package markets
+
+import "testing"
+
+func TestPlaceable(t *testing.T) {
+	rules := Default("BTCIRT")
+	rules.AmountStep = 0.001
+
+	tests := []struct {
+		name      string
+		remaining float64 // rials left to commit
+		price     float64
+		want      bool
+	}{
+		{"well above the minimum", 1e6, 1e8, true},
+		{"exactly the minimum", 1e5, 1e8, true},
+		// 110,000 rials buys 0.00122, rounded down to 0.001: 90,000 rials.
+		{"below the minimum once rounded", 110000, 9e7, false},
+		{"rounded to nothing", 5e4, 1e8, false},
+	}
+	for _, tt := range tests {
+		amount := rules.RoundAmount(tt.remaining / tt.price)
+		if got := rules.Placeable(amount, tt.price); got != tt.want {
+			t.Errorf("%s: Placeable(%v, %v) = %v, want %v", tt.name, amount, tt.price, got, tt.want)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package nobitex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
-// GetAvailableBalance returns the available RLS balance for margin trading.
-func GetAvailableBalance(apiToken string) (float64, error) {
-	url := baseURL + walletsEndpoint
-	respData, err := performAuthenticatedRequest(apiToken, http.MethodGet, url, nil)
+// GetAvailableBalance returns the available margin balance in currency, such
+// as "rls" or "usdt".
+func (c *Client) GetAvailableBalance(ctx context.Context, currency string) (float64, error) {
+	currency = strings.ToLower(currency)
+	respData, err := c.performAuthenticatedRequest(ctx, http.MethodGet, fmt.Sprintf(walletsEndpoint, currency), nil)
 	if err != nil {
 		return 0, err
 	}
@@ -20,12 +23,12 @@ func GetAvailableBalance(apiToken string) (float64, error) {
 		return 0, err
 	}
 	if balanceResp.Status != "ok" {
-		return 0, fmt.Errorf("failed to get balance: code=%s, msg=%s", balanceResp.Code, balanceResp.Message)
+		return 0, failed("get balance", balanceResp.Code, balanceResp.Message)
 	}
 
-	wallet, found := balanceResp.Wallets["RLS"]
+	wallet, found := balanceResp.Wallets[strings.ToUpper(currency)]
 	if !found {
-		return 0, fmt.Errorf("RLS wallet not found")
+		return 0, fmt.Errorf("%s wallet not found", strings.ToUpper(currency))
 	}
 
 	balance, err := strconv.ParseFloat(wallet.Balance, 64)
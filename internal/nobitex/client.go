@@ -2,25 +2,110 @@ package nobitex
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// Client talks to the Nobitex REST API. BaseURL can be pointed at the testnet,
+// a recording proxy or a local fake server.
+//
+// Requests wait for Limiter so that all goroutines sharing the client stay
+// under Nobitex's rate limits. Throttled reads, and writes the server refused
+// with 429, are retried with backoff; a nil Limiter disables both.
+type Client struct {
+	BaseURL    string
+	StreamURL  string
+	Token      string
+	UserAgent  string
+	HTTPClient *http.Client
+	Limiter    *RateLimiter
+}
+
+// NewClient returns a Client for the production API authenticated with apiToken.
+func NewClient(apiToken string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		StreamURL:  DefaultStreamURL,
+		Token:      apiToken,
+		UserAgent:  DefaultUserAgent,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Limiter:    NewRateLimiter(DefaultRateLimits),
+	}
+}
+
+// url joins the client's base URL with an endpoint path.
+func (c *Client) url(path string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + path
+}
+
 // performAuthenticatedRequest handles GET/POST requests with an auth token.
-func performAuthenticatedRequest(apiToken, method, url string, payload interface{}) ([]byte, error) {
+// Cancelling ctx aborts the request.
+func (c *Client) performAuthenticatedRequest(ctx context.Context, method, path string, payload interface{}) ([]byte, error) {
+	return c.performRequest(ctx, method, path, payload, true)
+}
+
+// performPublicRequest handles unauthenticated GET requests.
+func (c *Client) performPublicRequest(ctx context.Context, path string) ([]byte, error) {
+	return c.performRequest(ctx, http.MethodGet, path, nil, false)
+}
+
+// performRequest sends a request once the rate limit allows, retrying it when
+// it fails transiently. Writes are only retried on 429, when Nobitex is known
+// not to have acted on them.
+func (c *Client) performRequest(ctx context.Context, method, path string, payload interface{}, auth bool) ([]byte, error) {
+	group := endpointGroup(path)
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx, group); err != nil {
+				return nil, err
+			}
+		}
+		body, err := c.send(ctx, method, path, payload, auth)
+		if err == nil {
+			return body, nil
+		}
+
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+		if IsRateLimited(err) && c.Limiter != nil {
+			c.Limiter.record(group, func(s *RateLimitStats) { s.RateLimited++ })
+			c.Limiter.Pause(group, retryAfter)
+		}
+		retry := IsRateLimited(err) || (method == http.MethodGet && IsTransient(err))
+		if c.Limiter == nil || !retry || attempt >= maxRequestRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		c.Limiter.record(group, func(s *RateLimitStats) { s.Retries++ })
+
+		if c.Limiter.sleep(ctx, backoff(attempt+1, retryAfter)) != nil {
+			return nil, err
+		}
+	}
+}
+
+// send performs one HTTP request.
+func (c *Client) send(ctx context.Context, method, path string, payload interface{}, auth bool) ([]byte, error) {
 	var req *http.Request
 	var err error
 
+	url := c.url(path)
 	if method == http.MethodGet {
-		req, err = http.NewRequest(http.MethodGet, url, nil)
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	} else {
 		jsonData, e := json.Marshal(payload)
 		if e != nil {
 			return nil, fmt.Errorf("payload marshal error: %v", e)
 		}
-		req, err = http.NewRequest(method, url, bytes.NewBuffer(jsonData))
+		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
 		if err == nil {
 			req.Header.Set("Content-Type", "application/json")
 		}
@@ -29,21 +114,31 @@ func performAuthenticatedRequest(apiToken, method, url string, payload interface
 		return nil, fmt.Errorf("request creation error: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Token "+apiToken)
+	if auth {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request error: %v", err)
+		return nil, fmt.Errorf("request error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response error: %v", err)
+		return nil, fmt.Errorf("read response error: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("non-200 status: %d (%s) body=%s", resp.StatusCode, http.StatusText(resp.StatusCode), string(body))
+		apiErr := httpError(resp.StatusCode, body)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header, time.Now())
+		return nil, apiErr
 	}
 	return body, nil
 }
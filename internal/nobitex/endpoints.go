@@ -1,8 +1,21 @@
 package nobitex
 
 const (
-	baseURL                   = "https://api.nobitex.ir"
-	walletsEndpoint           = "/v2/wallets?currencies=rls&type=margin"
+	DefaultBaseURL   = "https://api.nobitex.ir"
+	DefaultUserAgent = "TraderBot/nobitex-sma-bot"
+	DefaultStreamURL = "wss://wss.nobitex.ir/connection/websocket"
+
+	walletsEndpoint           = "/v2/wallets?currencies=%s&type=margin"
 	updateOrderStatusEndpoint = "/market/orders/update-status"
+	orderStatusEndpoint       = "/market/orders/status"
+	ordersListEndpoint        = "/market/orders/list"
 	placeMarginOrderEndpoint  = "/margin/orders/add"
+	positionsListEndpoint     = "/positions/list"
+	positionStatusEndpoint    = "/positions/%d/status"
+	positionCloseEndpoint     = "/positions/%d/close"
+	udfHistoryEndpoint        = "/market/udf/history"
+	optionsEndpoint           = "/v2/options"
+	marginMarketsEndpoint     = "/margin/markets/list"
+	wsTokenEndpoint           = "/auth/ws/token/"
+	profileEndpoint           = "/users/profile"
 )
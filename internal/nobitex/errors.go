@@ -0,0 +1,117 @@
+package nobitex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// APIError is a request Nobitex answered with an error: either a non-200
+// HTTP status or a 200 response whose status is not "ok".
+type APIError struct {
+	Op         string // what was attempted, e.g. "place buy order"; empty for non-200 responses
+	HTTPStatus int
+	Code       string // Nobitex error code, e.g. InsufficientBalance
+	Message    string
+	Body       string        // raw response body when it carried no code or message
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Op != "" {
+		return fmt.Sprintf("failed to %s: code=%s, msg=%s", e.Op, e.Code, e.Message)
+	}
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("non-200 status: %d (%s) body=%s", e.HTTPStatus, http.StatusText(e.HTTPStatus), e.Body)
+	}
+	return fmt.Sprintf("non-200 status: %d (%s) code=%s, msg=%s", e.HTTPStatus, http.StatusText(e.HTTPStatus), e.Code, e.Message)
+}
+
+// failed returns the APIError for a 200 response whose status is not "ok".
+func failed(op, code, message string) *APIError {
+	return &APIError{Op: op, HTTPStatus: http.StatusOK, Code: code, Message: message}
+}
+
+// httpError returns the APIError for a non-200 response, taking the code and
+// message from the body when it is a Nobitex error document.
+func httpError(status int, body []byte) *APIError {
+	e := &APIError{HTTPStatus: status}
+	var doc struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Detail  string `json:"detail"`
+	}
+	if json.Unmarshal(body, &doc) == nil {
+		e.Code = doc.Code
+		e.Message = doc.Message
+		if e.Message == "" {
+			e.Message = doc.Detail
+		}
+	}
+	if e.Code == "" && e.Message == "" {
+		e.Body = string(body)
+	}
+	return e
+}
+
+// Error codes the classifiers below look for.
+var (
+	rateLimitCodes           = map[string]bool{"TooManyRequests": true, "RateLimitExceeded": true}
+	insufficientBalanceCodes = map[string]bool{"InsufficientBalance": true, "InsufficientBalanceForOrder": true}
+	authCodes                = map[string]bool{"InvalidToken": true, "AuthenticationFailed": true, "NotAuthenticated": true}
+	transientCodes           = map[string]bool{"TradingUnavailable": true, "ServiceUnavailable": true, "TryAgainLater": true}
+	invalidMarketCodes       = map[string]bool{"InvalidMarketPair": true, "InvalidMarket": true, "MarketNotFound": true}
+)
+
+// IsRateLimited reports whether err is Nobitex throttling the client.
+func IsRateLimited(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && (e.HTTPStatus == http.StatusTooManyRequests || rateLimitCodes[e.Code])
+}
+
+// IsInsufficientBalance reports whether err is an order rejected for lack of
+// funds in the wallet.
+func IsInsufficientBalance(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && insufficientBalanceCodes[e.Code]
+}
+
+// IsAuth reports whether err is the API token being missing, invalid or not
+// allowed to make the call.
+func IsAuth(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) &&
+		(e.HTTPStatus == http.StatusUnauthorized || e.HTTPStatus == http.StatusForbidden || authCodes[e.Code])
+}
+
+// IsTransient reports whether the same call may succeed if retried later:
+// throttling, timeouts, 5xx responses and network failures.
+func IsTransient(err error) bool {
+	if IsRateLimited(err) {
+		return true
+	}
+	var e *APIError
+	if errors.As(err, &e) {
+		return e.HTTPStatus >= 500 || e.HTTPStatus == http.StatusRequestTimeout || transientCodes[e.Code]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsInvalidMarket reports whether err names a market the exchange does not
+// trade.
+func IsInvalidMarket(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && invalidMarketCodes[e.Code]
+}
+
+// IsPermanent reports whether Nobitex rejected the call in a way retrying
+// cannot fix: an insufficient balance, a bad token or an invalid market. Any
+// other error, such as an order not found or in the wrong status, may clear
+// up and is not permanent.
+func IsPermanent(err error) bool {
+	return IsInsufficientBalance(err) || IsAuth(err) || IsInvalidMarket(err)
+}
@@ -0,0 +1,56 @@
+package nobitex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestErrorClassifiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+		permanent bool
+		auth      bool
+	}{
+		{"nil", nil, false, false, false},
+		{"plain error", errors.New("boom"), false, false, false},
+		{"context cancelled", context.Canceled, false, false, false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("refused")}, true, false, false},
+		{"wrapped network", fmt.Errorf("get: %w", &net.DNSError{Err: "no such host"}), true, false, false},
+		{"429", &APIError{HTTPStatus: http.StatusTooManyRequests}, true, false, false},
+		{"rate limit code", failed("place buy order", "TooManyRequests", ""), true, false, false},
+		{"500", &APIError{HTTPStatus: http.StatusInternalServerError}, true, false, false},
+		{"503", &APIError{HTTPStatus: http.StatusServiceUnavailable}, true, false, false},
+		{"408", &APIError{HTTPStatus: http.StatusRequestTimeout}, true, false, false},
+		{"trading unavailable", failed("place buy order", "TradingUnavailable", ""), true, false, false},
+		{"insufficient balance", failed("place buy order", "InsufficientBalance", ""), false, true, false},
+		{"wrapped insufficient balance", fmt.Errorf("entry: %w", failed("place sell order", "InsufficientBalanceForOrder", "")), false, true, false},
+		{"401", &APIError{HTTPStatus: http.StatusUnauthorized}, false, true, true},
+		{"403", &APIError{HTTPStatus: http.StatusForbidden}, false, true, true},
+		{"invalid token", failed("fetch positions", "InvalidToken", ""), false, true, true},
+		{"invalid market", failed("place buy order", "InvalidMarketPair", ""), false, true, false},
+		{"order not found", failed("cancel", "NotFound", "order 7 not found"), false, false, false},
+		{"404", &APIError{HTTPStatus: http.StatusNotFound}, false, false, false},
+		{"invalid status", failed("cancel", "InvalidStatus", "order 7 is Done"), false, false, false},
+		{"exceeds liability", failed("close position 3", "ExceedLiability", ""), false, false, false},
+		{"400 without code", &APIError{HTTPStatus: http.StatusBadRequest, Body: "bad"}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.transient {
+				t.Errorf("IsTransient = %v, want %v", got, tt.transient)
+			}
+			if got := IsPermanent(tt.err); got != tt.permanent {
+				t.Errorf("IsPermanent = %v, want %v", got, tt.permanent)
+			}
+			if got := IsAuth(tt.err); got != tt.auth {
+				t.Errorf("IsAuth = %v, want %v", got, tt.auth)
+			}
+		})
+	}
+}
@@ -1,41 +1,148 @@
 package nobitex
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// maxCandlesPerRequest bounds each /market/udf/history call; longer ranges
+// are fetched in chunks.
+const maxCandlesPerRequest = 500
+
+// ErrNoData is returned when the history endpoint has no candles in range.
+var ErrNoData = errors.New("nobitex: no OHLCV data in range")
+
+// Resolutions supported by /market/udf/history, in the endpoint's notation.
+var Resolutions = map[string]time.Duration{
+	"1":   time.Minute,
+	"5":   5 * time.Minute,
+	"15":  15 * time.Minute,
+	"30":  30 * time.Minute,
+	"60":  time.Hour,
+	"180": 3 * time.Hour,
+	"240": 4 * time.Hour,
+	"360": 6 * time.Hour,
+	"720": 12 * time.Hour,
+	"D":   24 * time.Hour,
+	"2D":  48 * time.Hour,
+	"3D":  72 * time.Hour,
+}
+
+// ResolutionDuration validates a resolution and returns its candle length.
+func ResolutionDuration(resolution string) (time.Duration, error) {
+	d, ok := Resolutions[strings.ToUpper(resolution)]
+	if !ok {
+		return 0, fmt.Errorf("invalid resolution %q", resolution)
+	}
+	return d, nil
+}
+
+// Candle is one OHLCV bar; Time is the bar's open time.
+type Candle struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
 type OHLCVHistory struct {
-	Status string    `json:"s"`
-	Close  []float64 `json:"c"`
+	Status   string    `json:"s"`
+	ErrMsg   string    `json:"errmsg,omitempty"`
+	NextTime int64     `json:"nextTime,omitempty"`
+	Time     []int64   `json:"t"`
+	Open     []float64 `json:"o"`
+	High     []float64 `json:"h"`
+	Low      []float64 `json:"l"`
+	Close    []float64 `json:"c"`
+	Volume   []float64 `json:"v"`
 }
 
-func GetOHLCVData(symbol, resolution string, from, to int64) ([]float64, error) {
-	url := fmt.Sprintf(
-		"https://api.nobitex.ir/market/udf/history?symbol=%s&resolution=%s&from=%d&to=%d",
-		symbol, resolution, from, to,
-	)
+// candles zips the parallel arrays into Candles.
+func (h *OHLCVHistory) candles() ([]Candle, error) {
+	n := len(h.Time)
+	for name, arr := range map[string][]float64{"o": h.Open, "h": h.High, "l": h.Low, "c": h.Close, "v": h.Volume} {
+		if len(arr) != n {
+			return nil, fmt.Errorf("OHLCV arrays differ in length: t=%d %s=%d", n, name, len(arr))
+		}
+	}
+	result := make([]Candle, n)
+	for i := range result {
+		result[i] = Candle{
+			Time:   time.Unix(h.Time[i], 0),
+			Open:   h.Open[i],
+			High:   h.High[i],
+			Low:    h.Low[i],
+			Close:  h.Close[i],
+			Volume: h.Volume[i],
+		}
+	}
+	return result, nil
+}
 
-	resp, err := http.Get(url)
+// GetOHLCVData fetches candles for symbol between from and to (unix seconds)
+// from the public UDF history endpoint, splitting long ranges into several
+// requests. It returns ErrNoData when the whole range is empty.
+func (c *Client) GetOHLCVData(ctx context.Context, symbol, resolution string, from, to int64) ([]Candle, error) {
+	step, err := ResolutionDuration(resolution)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch OHLCV data: %w", err)
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid OHLCV range: from=%d is after to=%d", from, to)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	span := int64(step/time.Second) * maxCandlesPerRequest
+	var result []Candle
+	for start := from; start <= to; start += span {
+		end := min(start+span-1, to)
+		chunk, err := c.getOHLCVChunk(ctx, symbol, resolution, start, end)
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, candle := range chunk {
+			if len(result) == 0 || candle.Time.After(result[len(result)-1].Time) {
+				result = append(result, candle)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrNoData
+	}
+	return result, nil
+}
+
+func (c *Client) getOHLCVChunk(ctx context.Context, symbol, resolution string, from, to int64) ([]Candle, error) {
+	path := fmt.Sprintf(
+		"%s?symbol=%s&resolution=%s&from=%s&to=%s",
+		udfHistoryEndpoint, symbol, strings.ToUpper(resolution),
+		strconv.FormatInt(from, 10), strconv.FormatInt(to, 10),
+	)
+
+	body, err := c.performPublicRequest(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read OHLCV response: %w", err)
+		return nil, fmt.Errorf("failed to fetch OHLCV data: %w", err)
 	}
 
 	var data OHLCVHistory
 	if err := json.Unmarshal(body, &data); err != nil {
 		return nil, fmt.Errorf("failed to parse OHLCV JSON: %w", err)
 	}
-	if data.Status != "ok" {
-		return nil, fmt.Errorf("Nobitex OHLCV error: status=%s", data.Status)
+	switch data.Status {
+	case "ok":
+		return data.candles()
+	case "no_data":
+		return nil, ErrNoData
+	default:
+		return nil, fmt.Errorf("Nobitex OHLCV error: status=%s, msg=%s", data.Status, data.ErrMsg)
 	}
-
-	return data.Close, nil
 }
@@ -0,0 +1,67 @@
+package nobitex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quoteCurrencies are the market symbol suffixes Nobitex quotes in, longest
+// first so that USDT is not mistaken for another suffix.
+var quoteCurrencies = []string{"USDT", "USDC", "DOGE", "IRT", "BTC", "ETH", "BNB"}
+
+// Market identifies a trading pair by its symbol and the currency names the
+// API uses for it.
+type Market struct {
+	Symbol string // uppercase, e.g. BTCIRT or BTCUSDT
+	Src    string // lowercase base currency, e.g. btc
+	Dst    string // lowercase quote currency; rls for IRT markets
+}
+
+// ParseMarket splits a market symbol into its currencies. IRT markets are
+// quoted in rials ("rls") by the order and wallet APIs.
+func ParseMarket(symbol string) (Market, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	for _, quote := range quoteCurrencies {
+		src, ok := strings.CutSuffix(symbol, quote)
+		if !ok {
+			continue
+		}
+		if src == "" {
+			return Market{}, fmt.Errorf("invalid pair: %s", symbol)
+		}
+		dst := strings.ToLower(quote)
+		if quote == "IRT" {
+			dst = "rls"
+		}
+		return Market{Symbol: symbol, Src: strings.ToLower(src), Dst: dst}, nil
+	}
+	return Market{}, fmt.Errorf("couldn't split pair: %s", symbol)
+}
+
+// SplitCurrencyPair splits a market symbol like "BTCIRT" into the lowercase
+// source and destination currencies used by the margin API.
+func SplitCurrencyPair(pair string) (string, string, error) {
+	m, err := ParseMarket(pair)
+	return m.Src, m.Dst, err
+}
+
+// OrderBookChannel is the market's public order book WebSocket channel.
+func (m Market) OrderBookChannel() string {
+	return "public:orderbook-" + m.Symbol
+}
+
+// TradesChannel is the market's public trades WebSocket channel.
+func (m Market) TradesChannel() string {
+	return "public:trades-" + m.Symbol
+}
+
+// CandleChannel is the market's public candle WebSocket channel at
+// resolution, given in the /market/udf/history notation.
+func (m Market) CandleChannel(resolution string) string {
+	return "public:candle-" + m.Symbol + "-" + strings.ToUpper(resolution)
+}
+
+// Rial reports whether the market is quoted in rials.
+func (m Market) Rial() bool {
+	return m.Dst == "rls"
+}
@@ -0,0 +1,111 @@
+package nobitex
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// MarketInfo is the trading rules of one market. Zero values are unknown.
+type MarketInfo struct {
+	Symbol        string
+	Src, Dst      string  // lowercase, as named by the margin API
+	PriceTick     float64 // prices are a multiple of this
+	AmountStep    float64 // amounts are a multiple of this
+	MinOrderValue float64 // smallest order notional, in the destination currency
+	MaxLeverage   float64
+	MarginEnabled bool
+}
+
+type optionsResponse struct {
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Nobitex struct {
+		AmountPrecisions map[string]string `json:"amountPrecisions"` // by market symbol
+		PricePrecisions  map[string]string `json:"pricePrecisions"`  // by market symbol
+		MinOrders        map[string]string `json:"minOrders"`        // by destination currency
+	} `json:"nobitex"`
+}
+
+type marginMarketsResponse struct {
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Markets map[string]struct {
+		SrcCurrency string `json:"srcCurrency"`
+		DstCurrency string `json:"dstCurrency"`
+		MaxLeverage string `json:"maxLeverage"`
+		BuyEnabled  bool   `json:"buyEnabled"`
+		SellEnabled bool   `json:"sellEnabled"`
+	} `json:"markets"`
+}
+
+// GetMarkets fetches the precision and minimum order rules of every market
+// from /v2/options and the leverage limits of margin markets, keyed by
+// uppercase market symbol.
+func (c *Client) GetMarkets(ctx context.Context) (map[string]MarketInfo, error) {
+	body, err := c.performPublicRequest(ctx, optionsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	var options optionsResponse
+	if err := json.Unmarshal(body, &options); err != nil {
+		return nil, err
+	}
+	if options.Status != "ok" {
+		return nil, failed("get options", options.Code, options.Message)
+	}
+
+	body, err = c.performPublicRequest(ctx, marginMarketsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	var margin marginMarketsResponse
+	if err := json.Unmarshal(body, &margin); err != nil {
+		return nil, err
+	}
+	if margin.Status != "ok" {
+		return nil, failed("list margin markets", margin.Code, margin.Message)
+	}
+
+	markets := make(map[string]MarketInfo)
+	get := func(symbol string) MarketInfo {
+		symbol = strings.ToUpper(symbol)
+		m, ok := markets[symbol]
+		if !ok {
+			m.Symbol = symbol
+		}
+		return m
+	}
+	for symbol, v := range options.Nobitex.AmountPrecisions {
+		m := get(symbol)
+		m.AmountStep, _ = strconv.ParseFloat(v, 64)
+		markets[m.Symbol] = m
+	}
+	for symbol, v := range options.Nobitex.PricePrecisions {
+		m := get(symbol)
+		m.PriceTick, _ = strconv.ParseFloat(v, 64)
+		markets[m.Symbol] = m
+	}
+	for symbol, v := range margin.Markets {
+		m := get(symbol)
+		m.Src, m.Dst = strings.ToLower(v.SrcCurrency), strings.ToLower(v.DstCurrency)
+		m.MaxLeverage, _ = strconv.ParseFloat(v.MaxLeverage, 64)
+		m.MarginEnabled = v.BuyEnabled || v.SellEnabled
+		markets[m.Symbol] = m
+	}
+	for symbol, m := range markets {
+		if m.Dst == "" {
+			parsed, err := ParseMarket(symbol)
+			if err != nil {
+				continue
+			}
+			m.Src, m.Dst = parsed.Src, parsed.Dst
+		}
+		m.MinOrderValue, _ = strconv.ParseFloat(options.Nobitex.MinOrders[m.Dst], 64)
+		markets[symbol] = m
+	}
+	return markets, nil
+}
@@ -1,8 +1,12 @@
 package nobitex
 
+import "time"
+
 type (
 	PositionsResponse struct {
 		Status    string     `json:"status"`
+		Code      string     `json:"code,omitempty"`
+		Message   string     `json:"message,omitempty"`
 		Positions []Position `json:"positions"`
 	}
 
@@ -21,6 +25,7 @@ type (
 		LiquidationPrice     string  `json:"liquidationPrice"`
 		EntryPrice           string  `json:"entryPrice"`
 		ExitPrice            *string `json:"exitPrice"`
+		PNL                  *string `json:"PNL"` // realized, once closed
 		DelegatedAmount      string  `json:"delegatedAmount"`
 		Liability            string  `json:"liability"`
 		TotalAsset           string  `json:"totalAsset"`
@@ -44,6 +49,31 @@ type OrderResponse struct {
 	} `json:"order"`
 }
 
+type (
+	OrdersResponse struct {
+		Status  string  `json:"status"`
+		Code    string  `json:"code,omitempty"`
+		Message string  `json:"message,omitempty"`
+		Orders  []Order `json:"orders"`
+	}
+
+	// Order is an order as returned by the orders list endpoint.
+	Order struct {
+		ID              int    `json:"id"`
+		Type            string `json:"type"` // buy or sell
+		Execution       string `json:"execution"`
+		TradeType       string `json:"tradeType"`
+		SrcCurrency     string `json:"srcCurrency"`
+		DstCurrency     string `json:"dstCurrency"`
+		Price           string `json:"price"`
+		Amount          string `json:"amount"`
+		MatchedAmount   string `json:"matchedAmount"`
+		UnmatchedAmount string `json:"unmatchedAmount"`
+		Status          string `json:"status"`
+		CreatedAt       string `json:"created_at"`
+	}
+)
+
 type CancelOrderResponse struct {
 	Status        string `json:"status"`
 	Code          string `json:"code,omitempty"`
@@ -61,3 +91,32 @@ type BalanceResponse struct {
 		Blocked string `json:"blocked"`
 	} `json:"wallets"`
 }
+
+type ClosePositionResponse struct {
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Order   struct {
+		ID int `json:"id"`
+	} `json:"order"`
+	Orders []struct {
+		ID int `json:"id"`
+	} `json:"orders"`
+}
+
+type (
+	// rawOrderBook carries the raw (string) bids/asks from the WebSocket.
+	rawOrderBook struct {
+		Asks       [][]string `json:"asks"`
+		Bids       [][]string `json:"bids"`
+		LastUpdate int64      `json:"lastUpdate"` // unix milliseconds
+	}
+
+	// OrderBook keeps numeric [price, amount] levels, best first. UpdatedAt
+	// is the exchange's time of the snapshot, zero when it was not sent.
+	OrderBook struct {
+		Asks      [][2]float64
+		Bids      [][2]float64
+		UpdatedAt time.Time
+	}
+)
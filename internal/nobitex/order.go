@@ -1,21 +1,20 @@
 package nobitex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 // CancelOrder attempts to cancel an existing order by its ID.
-func CancelOrder(apiToken string, orderID int) error {
-	url := baseURL + updateOrderStatusEndpoint
+func (c *Client) CancelOrder(ctx context.Context, orderID int) error {
 	payload := map[string]interface{}{
 		"order":  orderID,
 		"status": "canceled",
 	}
-	respData, err := performAuthenticatedRequest(apiToken, http.MethodPost, url, payload)
+	respData, err := c.performAuthenticatedRequest(ctx, http.MethodPost, updateOrderStatusEndpoint, payload)
 	if err != nil {
 		return err
 	}
@@ -25,17 +24,16 @@ func CancelOrder(apiToken string, orderID int) error {
 		return err
 	}
 	if cancelResp.Status != "ok" {
-		return fmt.Errorf("failed to cancel: code=%s, msg=%s", cancelResp.Code, cancelResp.Message)
+		return failed("cancel", cancelResp.Code, cancelResp.Message)
 	}
 
 	return nil
 }
 
-// PlaceMarginOrder creates a margin limit order (buy or sell) and returns its ID.
-func PlaceMarginOrder(apiToken, currencyPair, leverage, orderType string, amount, price float64) (int, error) {
-	url := baseURL + placeMarginOrderEndpoint
-
-	src, dst, err := splitCurrencyPair(currencyPair)
+// PlaceMarginOrder creates a margin limit order (buy or sell) and returns its
+// ID. amount and price must already be rounded to the market's rules.
+func (c *Client) PlaceMarginOrder(ctx context.Context, currencyPair, leverage, orderType string, amount, price float64) (int, error) {
+	src, dst, err := SplitCurrencyPair(currencyPair)
 	if err != nil {
 		return 0, err
 	}
@@ -49,10 +47,10 @@ func PlaceMarginOrder(apiToken, currencyPair, leverage, orderType string, amount
 		"dstCurrency": dst,
 		"type":        orderType,
 		"leverage":    leverage,
-		"amount":      fmt.Sprintf("%.8f", amount),
-		"price":       fmt.Sprintf("%.0f", price),
+		"amount":      strconv.FormatFloat(amount, 'f', -1, 64),
+		"price":       strconv.FormatFloat(price, 'f', -1, 64),
 	}
-	respData, err := performAuthenticatedRequest(apiToken, http.MethodPost, url, payload)
+	respData, err := c.performAuthenticatedRequest(ctx, http.MethodPost, placeMarginOrderEndpoint, payload)
 	if err != nil {
 		return 0, err
 	}
@@ -62,26 +60,28 @@ func PlaceMarginOrder(apiToken, currencyPair, leverage, orderType string, amount
 		return 0, err
 	}
 	if orderResp.Status != "ok" {
-		return 0, fmt.Errorf("failed to place %s order: code=%s, msg=%s", orderType, orderResp.Code, orderResp.Message)
+		return 0, failed("place "+orderType+" order", orderResp.Code, orderResp.Message)
 	}
 
 	return orderResp.Order.ID, nil
 }
 
-func CheckOrderStatus(apiToken string, orderID int) (string, float64, error) {
-	url := "https://api.nobitex.ir/market/orders/status"
+// CheckOrderStatus returns an order's status and the amount matched so far.
+func (c *Client) CheckOrderStatus(ctx context.Context, orderID int) (string, float64, error) {
 	payload := map[string]interface{}{
 		"id": orderID,
 	}
 
-	responseData, err := performAuthenticatedRequest(apiToken, http.MethodPost, url, payload)
+	responseData, err := c.performAuthenticatedRequest(ctx, http.MethodPost, orderStatusEndpoint, payload)
 	if err != nil {
 		return "", 0, err
 	}
 
 	var statusResponse struct {
-		Status string `json:"status"`
-		Order  struct {
+		Status  string `json:"status"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+		Order   struct {
 			Status        string `json:"status"`
 			MatchedAmount string `json:"matchedAmount"`
 			Unmatched     string `json:"unmatchedAmount"`
@@ -91,21 +91,77 @@ func CheckOrderStatus(apiToken string, orderID int) (string, float64, error) {
 	if err := json.Unmarshal(responseData, &statusResponse); err != nil {
 		return "", 0, err
 	}
+	if statusResponse.Status != "ok" {
+		return "", 0, failed(fmt.Sprintf("check order %d", orderID), statusResponse.Code, statusResponse.Message)
+	}
 
 	// Convert matched amount
 	matchedAmount, _ := strconv.ParseFloat(statusResponse.Order.MatchedAmount, 64)
 	return statusResponse.Order.Status, matchedAmount, nil
 }
-func splitCurrencyPair(pair string) (string, string, error) {
-	dstCurrencies := []string{"IRT", "USDT", "BTC", "ETH", "USDC", "BNB", "DOGE"}
-	for _, dst := range dstCurrencies {
-		if strings.HasSuffix(pair, dst) {
-			src := strings.TrimSuffix(pair, dst)
-			if src == "" {
-				return "", "", fmt.Errorf("invalid pair: %s", pair)
-			}
-			return strings.ToLower(src), "rls", nil
-		}
-	}
-	return "", "", fmt.Errorf("couldn't split pair: %s", pair)
+
+// GetOpenMarginOrders lists the open margin orders on currencyPair, including
+// untriggered stop orders and the legs of OCO close orders.
+func (c *Client) GetOpenMarginOrders(ctx context.Context, currencyPair string) ([]Order, error) {
+	src, dst, err := SplitCurrencyPair(currencyPair)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s?status=open&tradeType=margin&srcCurrency=%s&dstCurrency=%s&details=2", ordersListEndpoint, src, dst)
+	body, err := c.performAuthenticatedRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response OrdersResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Status != "ok" {
+		return nil, failed("list orders", response.Code, response.Message)
+	}
+	return response.Orders, nil
+}
+
+// ClosePositionOCO places an OCO order closing amount of a position: a limit at
+// takeProfitPrice and a stop-limit at stopLimitPrice triggered at stopPrice.
+// It returns the ID of the first order in the pair.
+func (c *Client) ClosePositionOCO(ctx context.Context, positionID int, amount, takeProfitPrice, stopPrice, stopLimitPrice float64) (int, error) {
+	payload := map[string]interface{}{
+		"amount":         strconv.FormatFloat(amount, 'f', -1, 64),
+		"price":          strconv.FormatFloat(takeProfitPrice, 'f', -1, 64),
+		"mode":           "oco",
+		"stopPrice":      strconv.FormatFloat(stopPrice, 'f', -1, 64),
+		"stopLimitPrice": strconv.FormatFloat(stopLimitPrice, 'f', -1, 64),
+	}
+	return c.closePosition(ctx, positionID, payload)
+}
+
+// ClosePosition places a single limit order closing amount of a position at price.
+func (c *Client) ClosePosition(ctx context.Context, positionID int, amount, price float64) (int, error) {
+	payload := map[string]interface{}{
+		"amount": strconv.FormatFloat(amount, 'f', -1, 64),
+		"price":  strconv.FormatFloat(price, 'f', -1, 64),
+	}
+	return c.closePosition(ctx, positionID, payload)
+}
+
+func (c *Client) closePosition(ctx context.Context, positionID int, payload map[string]interface{}) (int, error) {
+	respData, err := c.performAuthenticatedRequest(ctx, http.MethodPost, fmt.Sprintf(positionCloseEndpoint, positionID), payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var closeResp ClosePositionResponse
+	if err := json.Unmarshal(respData, &closeResp); err != nil {
+		return 0, err
+	}
+	if closeResp.Status != "ok" {
+		return 0, failed(fmt.Sprintf("close position %d", positionID), closeResp.Code, closeResp.Message)
+	}
+
+	if len(closeResp.Orders) > 0 {
+		return closeResp.Orders[0].ID, nil
+	}
+	return closeResp.Order.ID, nil
 }
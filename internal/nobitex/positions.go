@@ -1,29 +1,18 @@
 package nobitex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
 )
 
-// GetOpenPositions retrieves all active positions for the given srcCurrency.
-func GetOpenPositions(apiToken, srcCurrency string) ([]Position, error) {
-	url := fmt.Sprintf("https://api.nobitex.ir/positions/list?srcCurrency=%s&status=active", srcCurrency)
-
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Token "+apiToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+// GetOpenPositions retrieves the active positions in srcCurrency, keeping only
+// those quoted in dstCurrency when it is set.
+func (c *Client) GetOpenPositions(ctx context.Context, srcCurrency, dstCurrency string) ([]Position, error) {
+	path := fmt.Sprintf("%s?srcCurrency=%s&status=active", positionsListEndpoint, srcCurrency)
+	body, err := c.performAuthenticatedRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -33,41 +22,38 @@ func GetOpenPositions(apiToken, srcCurrency string) ([]Position, error) {
 		return nil, err
 	}
 	if response.Status != "ok" {
-		return nil, fmt.Errorf("failed to fetch positions, got: %v", response)
+		return nil, failed("fetch positions", response.Code, response.Message)
 	}
-	return response.Positions, nil
-}
-
-// GetPositionDetails fetches details of a specific position by ID.
-func GetPositionDetails(apiToken string, positionID int) (*Position, error) {
-	url := fmt.Sprintf("https://api.nobitex.ir/positions/%d/status", positionID)
-
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+	if dstCurrency == "" {
+		return response.Positions, nil
 	}
-	req.Header.Set("Authorization", "Token "+apiToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	var positions []Position
+	for _, pos := range response.Positions {
+		if strings.EqualFold(pos.DstCurrency, dstCurrency) {
+			positions = append(positions, pos)
+		}
 	}
-	defer resp.Body.Close()
+	return positions, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// GetPositionDetails fetches details of a specific position by ID.
+func (c *Client) GetPositionDetails(ctx context.Context, positionID int) (*Position, error) {
+	body, err := c.performAuthenticatedRequest(ctx, http.MethodGet, fmt.Sprintf(positionStatusEndpoint, positionID), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var data struct {
 		Status   string   `json:"status"`
+		Code     string   `json:"code,omitempty"`
+		Message  string   `json:"message,omitempty"`
 		Position Position `json:"position"`
 	}
 	if err := json.Unmarshal(body, &data); err != nil {
 		return nil, err
 	}
 	if data.Status != "ok" {
-		return nil, fmt.Errorf("failed to fetch position details, status: %s", data.Status)
+		return nil, failed(fmt.Sprintf("fetch position %d details", positionID), data.Code, data.Message)
 	}
 	return &data.Position, nil
 }
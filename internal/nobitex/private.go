@@ -0,0 +1,239 @@
+package nobitex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/centrifuge-go"
+)
+
+// Private WebSocket channel prefixes; the account's websocketAuthParam
+// follows the '#'.
+const (
+	privateOrdersChannel = "private:orders#"
+	privateTradesChannel = "private:trades#"
+)
+
+// IsPrivateOrdersChannel reports whether channel is an account's private
+// orders channel.
+func IsPrivateOrdersChannel(channel string) bool {
+	return strings.HasPrefix(channel, privateOrdersChannel)
+}
+
+// OrderEvent is an update of one of the account's orders from the private
+// orders channel: placed, partly or fully matched, or cancelled, including
+// the legs of OCO orders.
+type OrderEvent struct {
+	OrderID     int
+	SrcCurrency string
+	DstCurrency string
+	Side        string // buy or sell
+	Execution   string // Limit, StopLimit, ...
+	TradeType   string // Spot or Margin
+	Status      string // Active, Inactive, Done or Canceled
+	Price       float64
+	Amount      float64
+	Matched     float64
+	Time        time.Time
+}
+
+// UserTrade is one fill of one of the account's orders from the private
+// trades channel.
+type UserTrade struct {
+	ID          int
+	OrderID     int
+	SrcCurrency string
+	DstCurrency string
+	Side        string
+	Price       float64
+	Amount      float64
+	Fee         float64
+	Time        time.Time
+}
+
+// PrivateHandlers are the callbacks invoked by a private WebSocket
+// subscription. Any of them may be nil.
+type PrivateHandlers struct {
+	OnConnected    func()
+	OnDisconnected func(reason string)
+	OnSubscribed   func(channel string, recovered bool)
+	OnError        func(err error)
+	OnOrder        func(event OrderEvent)
+	OnTrade        func(trade UserTrade)
+}
+
+// SubscribePrivate connects to the WebSocket with a connection token for the
+// client's API token and streams the account's order updates and trades to
+// handlers until ctx is cancelled. The token is fetched again whenever the
+// connection needs a new one.
+func (c *Client) SubscribePrivate(ctx context.Context, handlers PrivateHandlers) error {
+	if c.Token == "" {
+		return errors.New("private WebSocket channels need an API token")
+	}
+	param, err := c.GetWebSocketAuthParam(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := c.GetWebSocketToken(ctx)
+	if err != nil {
+		return err
+	}
+	config := centrifuge.Config{
+		Token: token,
+		GetToken: func(centrifuge.ConnectionTokenEvent) (string, error) {
+			return c.GetWebSocketToken(ctx)
+		},
+	}
+
+	channels := map[string]func(data []byte) error{
+		privateOrdersChannel + param: func(data []byte) error {
+			var raw rawOrderEvent
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("error parsing order event: %w", err)
+			}
+			if handlers.OnOrder != nil {
+				handlers.OnOrder(raw.event())
+			}
+			return nil
+		},
+		privateTradesChannel + param: func(data []byte) error {
+			var raw rawUserTrade
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("error parsing trade event: %w", err)
+			}
+			if handlers.OnTrade != nil {
+				handlers.OnTrade(raw.trade())
+			}
+			return nil
+		},
+	}
+	hooks := streamHooks{
+		onConnected:    handlers.OnConnected,
+		onDisconnected: handlers.OnDisconnected,
+		onSubscribed:   handlers.OnSubscribed,
+		onError:        handlers.OnError,
+	}
+	return c.stream(ctx, config, channels, hooks)
+}
+
+// GetWebSocketToken fetches a short-lived connection token for the private
+// WebSocket channels.
+func (c *Client) GetWebSocketToken(ctx context.Context) (string, error) {
+	responseData, err := c.performAuthenticatedRequest(ctx, http.MethodGet, wsTokenEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Status  string `json:"status"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+		Token   string `json:"token"`
+	}
+	if err := json.Unmarshal(responseData, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse WebSocket token response: %w", err)
+	}
+	if resp.Status != "ok" {
+		return "", failed("fetch WebSocket token", resp.Code, resp.Message)
+	}
+	return resp.Token, nil
+}
+
+// GetWebSocketAuthParam fetches the account's websocketAuthParam, which
+// names its private channels.
+func (c *Client) GetWebSocketAuthParam(ctx context.Context) (string, error) {
+	responseData, err := c.performAuthenticatedRequest(ctx, http.MethodGet, profileEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Status  string `json:"status"`
+		Code    string `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+		Profile struct {
+			WebsocketAuthParam string `json:"websocketAuthParam"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(responseData, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse profile response: %w", err)
+	}
+	if resp.Status != "ok" {
+		return "", failed("fetch profile", resp.Code, resp.Message)
+	}
+	if resp.Profile.WebsocketAuthParam == "" {
+		return "", failed("fetch profile", "", "no websocketAuthParam in profile")
+	}
+	return resp.Profile.WebsocketAuthParam, nil
+}
+
+type rawOrderEvent struct {
+	OrderID       int    `json:"orderId"`
+	ID            int    `json:"id"`
+	SrcCurrency   string `json:"srcCurrency"`
+	DstCurrency   string `json:"dstCurrency"`
+	Type          string `json:"type"`
+	Side          string `json:"side"`
+	Execution     string `json:"execution"`
+	TradeType     string `json:"tradeType"`
+	Status        string `json:"status"`
+	Price         number `json:"price"`
+	Amount        number `json:"amount"`
+	MatchedAmount number `json:"matchedAmount"`
+	EventTime     int64  `json:"eventTime"` // unix milliseconds
+}
+
+func (r rawOrderEvent) event() OrderEvent {
+	e := OrderEvent{
+		OrderID:     r.OrderID,
+		SrcCurrency: strings.ToLower(r.SrcCurrency),
+		DstCurrency: strings.ToLower(r.DstCurrency),
+		Side:        strings.ToLower(r.Type),
+		Execution:   r.Execution,
+		TradeType:   r.TradeType,
+		Status:      r.Status,
+		Price:       float64(r.Price),
+		Amount:      float64(r.Amount),
+		Matched:     float64(r.MatchedAmount),
+	}
+	if e.OrderID == 0 {
+		e.OrderID = r.ID
+	}
+	if e.Side == "" {
+		e.Side = strings.ToLower(r.Side)
+	}
+	if r.EventTime > 0 {
+		e.Time = time.UnixMilli(r.EventTime)
+	}
+	return e
+}
+
+type rawUserTrade struct {
+	ID          int    `json:"id"`
+	OrderID     int    `json:"orderId"`
+	SrcCurrency string `json:"srcCurrency"`
+	DstCurrency string `json:"dstCurrency"`
+	Type        string `json:"type"`
+	Price       number `json:"price"`
+	Amount      number `json:"amount"`
+	Fee         number `json:"fee"`
+	Timestamp   string `json:"timestamp"` // RFC 3339
+}
+
+func (r rawUserTrade) trade() UserTrade {
+	t := UserTrade{
+		ID:          r.ID,
+		OrderID:     r.OrderID,
+		SrcCurrency: strings.ToLower(r.SrcCurrency),
+		DstCurrency: strings.ToLower(r.DstCurrency),
+		Side:        strings.ToLower(r.Type),
+		Price:       float64(r.Price),
+		Amount:      float64(r.Amount),
+		Fee:         float64(r.Fee),
+	}
+	t.Time, _ = time.Parse(time.RFC3339Nano, r.Timestamp)
+	return t
+}
@@ -0,0 +1,144 @@
+package nobitex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge-go"
+)
+
+func TestRawOrderEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want OrderEvent
+	}{
+		{
+			name: "limit order matched",
+			data: `{"orderId":1001,"srcCurrency":"BTC","dstCurrency":"RLS","type":"buy","execution":"Limit","tradeType":"Margin",
+				"status":"Done","price":"8000000000","amount":"0.01","matchedAmount":"0.01","eventTime":1699356578813}`,
+			want: OrderEvent{OrderID: 1001, SrcCurrency: "btc", DstCurrency: "rls", Side: "buy", Execution: "Limit", TradeType: "Margin",
+				Status: "Done", Price: 8e9, Amount: 0.01, Matched: 0.01, Time: time.UnixMilli(1699356578813)},
+		},
+		{
+			name: "id and side fallbacks",
+			data: `{"id":1002,"srcCurrency":"usdt","dstCurrency":"rls","side":"SELL","execution":"StopLimit",
+				"status":"Canceled","price":600000,"amount":12.5,"matchedAmount":0}`,
+			want: OrderEvent{OrderID: 1002, SrcCurrency: "usdt", DstCurrency: "rls", Side: "sell", Execution: "StopLimit",
+				Status: "Canceled", Price: 600000, Amount: 12.5},
+		},
+		{
+			name: "orderId preferred over id",
+			data: `{"orderId":7,"id":8,"type":"Sell","status":"Active","matchedAmount":""}`,
+			want: OrderEvent{OrderID: 7, Side: "sell", Status: "Active"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw rawOrderEvent
+			if err := json.Unmarshal([]byte(tt.data), &raw); err != nil {
+				t.Fatal(err)
+			}
+			if got := raw.event(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawUserTrade(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want UserTrade
+	}{
+		{
+			name: "full trade",
+			data: `{"id":55,"orderId":1001,"srcCurrency":"BTC","dstCurrency":"RLS","type":"buy","price":"8000000000",
+				"amount":"0.004","fee":"83200","timestamp":"2023-11-07T11:29:38.813+00:00"}`,
+			want: UserTrade{ID: 55, OrderID: 1001, SrcCurrency: "btc", DstCurrency: "rls", Side: "buy", Price: 8e9,
+				Amount: 0.004, Fee: 83200, Time: time.Date(2023, 11, 7, 11, 29, 38, 813000000, time.FixedZone("", 0))},
+		},
+		{
+			name: "bad timestamp",
+			data: `{"id":56,"orderId":1002,"type":"SELL","price":1,"amount":2,"fee":0,"timestamp":"yesterday"}`,
+			want: UserTrade{ID: 56, OrderID: 1002, Side: "sell", Price: 1, Amount: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw rawUserTrade
+			if err := json.Unmarshal([]byte(tt.data), &raw); err != nil {
+				t.Fatal(err)
+			}
+			got := raw.trade()
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time, tt.want.Time = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPrivateOrdersChannel(t *testing.T) {
+	for channel, want := range map[string]bool{
+		"private:orders#abc":       true,
+		"private:trades#abc":       false,
+		"public:orderbook-BTCIRT":  false,
+		"private:orders#":          true,
+		"xprivate:orders#anything": false,
+	} {
+		if got := IsPrivateOrdersChannel(channel); got != want {
+			t.Errorf("IsPrivateOrdersChannel(%q) = %v, want %v", channel, got, want)
+		}
+	}
+}
+
+func TestSubscribePrivateReleasesFailedConnections(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(profileEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok","profile":{"websocketAuthParam":"abc"}}`)
+	})
+	mux.HandleFunc(wsTokenEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok","token":"t"}`)
+	})
+	// Every other path, the WebSocket included, refuses the connection.
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := &Client{
+		BaseURL:    srv.URL,
+		StreamURL:  "ws" + strings.TrimPrefix(srv.URL, "http") + "/connection/websocket",
+		Token:      "key",
+		HTTPClient: &http.Client{Transport: &http.Transport{DisableKeepAlives: true}},
+	}
+
+	base := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if err := c.SubscribePrivate(context.Background(), PrivateHandlers{}); err == nil {
+			t.Fatal("subscribed through a refused connection")
+		}
+	}
+	if n := settledGoroutines(base); n > base {
+		t.Errorf("goroutines grew from %d to %d over failed connections", base, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.stream(ctx, centrifuge.Config{}, map[string]func([]byte) error{"private:orders#abc": nil}, streamHooks{}); err == nil {
+		t.Fatal("stream started with a cancelled context")
+	}
+	if n := settledGoroutines(base); n > base {
+		t.Errorf("goroutines grew from %d to %d after a stream failed to start", base, n)
+	}
+}
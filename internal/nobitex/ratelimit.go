@@ -0,0 +1,249 @@
+package nobitex
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Requests calls every Per, in bursts of up to Requests.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Endpoint groups sharing one rate limit.
+const (
+	GroupOrders    = "orders"    // placing margin orders and closing positions
+	GroupCancel    = "cancel"    // cancelling orders
+	GroupStatus    = "status"    // checking one order
+	GroupOrderList = "orderList" // listing orders
+	GroupPositions = "positions" // listing and checking positions
+	GroupWallets   = "wallets"
+	GroupMarket    = "market" // public market data and options
+)
+
+// DefaultRateLimits follow Nobitex's published per-user limits, rounded down
+// so that the client stays under them.
+var DefaultRateLimits = map[string]RateLimit{
+	GroupOrders:    {Requests: 300, Per: 10 * time.Minute},
+	GroupCancel:    {Requests: 90, Per: time.Minute},
+	GroupStatus:    {Requests: 300, Per: time.Minute},
+	GroupOrderList: {Requests: 30, Per: time.Minute},
+	GroupPositions: {Requests: 100, Per: time.Minute},
+	GroupWallets:   {Requests: 20, Per: time.Minute},
+	GroupMarket:    {Requests: 60, Per: time.Minute},
+}
+
+// endpointGroup maps a request path to its rate limit group.
+func endpointGroup(path string) string {
+	switch {
+	case strings.HasPrefix(path, placeMarginOrderEndpoint),
+		strings.HasPrefix(path, "/positions/") && strings.HasSuffix(path, "/close"):
+		return GroupOrders
+	case strings.HasPrefix(path, updateOrderStatusEndpoint):
+		return GroupCancel
+	case strings.HasPrefix(path, orderStatusEndpoint):
+		return GroupStatus
+	case strings.HasPrefix(path, ordersListEndpoint):
+		return GroupOrderList
+	case strings.HasPrefix(path, "/positions/"):
+		return GroupPositions
+	case strings.HasPrefix(path, "/v2/wallets"):
+		return GroupWallets
+	default:
+		return GroupMarket
+	}
+}
+
+// RateLimitStats counts one group's calls since the limiter was created.
+type RateLimitStats struct {
+	Requests    int           // requests sent
+	Throttled   int           // requests delayed by the client-side limit
+	Waited      time.Duration // total time spent waiting for the limit
+	RateLimited int           // 429 responses received
+	Retries     int           // requests sent again after a transient failure
+}
+
+// RateLimiter is a set of token buckets, one per endpoint group, shared by
+// every goroutine using the client. Groups without a limit are not throttled.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stats   map[string]*RateLimitStats
+
+	// now and sleep are the limiter's clock, replaced in tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateLimiter returns a limiter enforcing limits, keyed by group.
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	return newRateLimiter(limits, time.Now, sleepContext)
+}
+
+func newRateLimiter(limits map[string]RateLimit, now func() time.Time, sleep func(context.Context, time.Duration) error) *RateLimiter {
+	l := &RateLimiter{
+		buckets: make(map[string]*bucket),
+		stats:   make(map[string]*RateLimitStats),
+		now:     now,
+		sleep:   sleep,
+	}
+	for group, limit := range limits {
+		if limit.Requests > 0 && limit.Per > 0 {
+			l.buckets[group] = &bucket{
+				rate:   float64(limit.Requests) / limit.Per.Seconds(),
+				burst:  float64(limit.Requests),
+				tokens: float64(limit.Requests),
+				last:   now(),
+			}
+		}
+	}
+	return l
+}
+
+// Wait blocks until group may send a request, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, group string) error {
+	b := l.buckets[group]
+	var wait time.Duration
+	if b != nil {
+		wait = b.reserve(l.now())
+	}
+	l.record(group, func(s *RateLimitStats) {
+		s.Requests++
+		if wait > 0 {
+			s.Throttled++
+			s.Waited += wait
+		}
+	})
+	if wait <= 0 {
+		return nil
+	}
+	if err := l.sleep(ctx, wait); err != nil {
+		b.cancel()
+		return err
+	}
+	return nil
+}
+
+// Pause holds back every request in group for d, as asked by a Retry-After
+// header or a 429 response.
+func (l *RateLimiter) Pause(group string, d time.Duration) {
+	if b := l.buckets[group]; b != nil {
+		b.pause(l.now().Add(d))
+	}
+}
+
+// Stats returns a snapshot of the counters of every group used so far.
+func (l *RateLimiter) Stats() map[string]RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]RateLimitStats, len(l.stats))
+	for group, s := range l.stats {
+		stats[group] = *s
+	}
+	return stats
+}
+
+func (l *RateLimiter) record(group string, fn func(*RateLimitStats)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.stats[group]
+	if !ok {
+		s = &RateLimitStats{}
+		l.stats[group] = s
+	}
+	fn(s)
+}
+
+// bucket is a token bucket refilled at rate tokens per second. Tokens go
+// negative while callers are queued for them.
+type bucket struct {
+	mu          sync.Mutex
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	if b.pausedUntil.After(now) {
+		wait = max(wait, b.pausedUntil.Sub(now))
+	}
+	return wait
+}
+
+// cancel gives back a token reserved by a caller that stopped waiting.
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+func (b *bucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	// The server's limit was hit, so the bucket is emptier than it thinks.
+	b.tokens = min(b.tokens, 0)
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Backoff settings for retried requests.
+const (
+	maxRequestRetries = 3
+	baseRetryDelay    = 500 * time.Millisecond
+	maxBackoffDelay   = 30 * time.Second
+)
+
+// backoff is the delay before the nth retry: exponential with jitter, or the
+// server's Retry-After when it asked for longer.
+func backoff(n int, retryAfter time.Duration) time.Duration {
+	d := min(baseRetryDelay<<min(n-1, 10), maxBackoffDelay)
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	return max(d, retryAfter)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+// relative to now.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
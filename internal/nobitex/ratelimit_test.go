@@ -0,0 +1,270 @@
+package nobitex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock stands in for the limiter's clock: sleeping moves it forward
+// straight away and records how long was slept.
+type fakeClock struct {
+	mu    sync.Mutex
+	t     time.Time
+	slept []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	c.slept = append(c.slept, d)
+	return nil
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// takeSlept returns and clears the sleeps recorded so far.
+func (c *fakeClock) takeSlept() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slept := c.slept
+	c.slept = nil
+	return slept
+}
+
+func (c *fakeClock) limiter(limits map[string]RateLimit) *RateLimiter {
+	return newRateLimiter(limits, c.now, c.sleep)
+}
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	clock := newFakeClock()
+	l := clock.limiter(map[string]RateLimit{GroupCancel: {Requests: 2, Per: time.Second}})
+	ctx := context.Background()
+
+	wait := func() time.Duration {
+		t.Helper()
+		if err := l.Wait(ctx, GroupCancel); err != nil {
+			t.Fatal(err)
+		}
+		var total time.Duration
+		for _, d := range clock.takeSlept() {
+			total += d
+		}
+		return total
+	}
+
+	// The bucket starts full: a burst of two goes straight through.
+	if d := wait(); d != 0 {
+		t.Fatalf("first request waited %v", d)
+	}
+	if d := wait(); d != 0 {
+		t.Fatalf("second request waited %v", d)
+	}
+	// The third waits for one token at two per second.
+	if d := wait(); d != 500*time.Millisecond {
+		t.Fatalf("third request waited %v, want 500ms", d)
+	}
+
+	// A long idle refills only up to the burst.
+	clock.advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		if d := wait(); d != 0 {
+			t.Fatalf("request %d after idle waited %v", i+1, d)
+		}
+	}
+	if d := wait(); d != 500*time.Millisecond {
+		t.Fatalf("request past the burst waited %v, want 500ms", d)
+	}
+
+	// Groups without a limit are never held back.
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(ctx, GroupMarket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if slept := clock.takeSlept(); len(slept) != 0 {
+		t.Fatalf("unlimited group slept %v", slept)
+	}
+
+	stats := l.Stats()[GroupCancel]
+	if stats.Requests != 6 || stats.Throttled != 2 || stats.Waited != time.Second {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	clock := newFakeClock()
+	l := clock.limiter(map[string]RateLimit{GroupStatus: {Requests: 10, Per: time.Second}})
+	ctx := context.Background()
+
+	l.Pause(GroupStatus, 3*time.Second)
+	if err := l.Wait(ctx, GroupStatus); err != nil {
+		t.Fatal(err)
+	}
+	if slept := clock.takeSlept(); len(slept) != 1 || slept[0] != 3*time.Second {
+		t.Fatalf("slept %v, want the 3s pause", slept)
+	}
+
+	// A shorter pause does not cut a longer one short.
+	l.Pause(GroupStatus, 2*time.Second)
+	l.Pause(GroupStatus, time.Second)
+	if err := l.Wait(ctx, GroupStatus); err != nil {
+		t.Fatal(err)
+	}
+	if slept := clock.takeSlept(); len(slept) != 1 || slept[0] != 2*time.Second {
+		t.Fatalf("slept %v, want the 2s pause", slept)
+	}
+
+	// A cancelled wait hands its token back, leaving the refilled bucket full.
+	l.Pause(GroupStatus, time.Second)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Wait(cancelled, GroupStatus); err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if tokens := l.buckets[GroupStatus].tokens; tokens != 10 {
+		t.Errorf("tokens after a cancelled wait = %v, want 10", tokens)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := parseRetryAfter(header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n := 1; n <= 20; n++ {
+		full := min(baseRetryDelay<<min(n-1, 10), maxBackoffDelay)
+		for i := 0; i < 50; i++ {
+			if d := backoff(n, 0); d < full/2 || d > full {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", n, d, full/2, full)
+			}
+		}
+	}
+	if d := backoff(1, time.Minute); d != time.Minute {
+		t.Errorf("backoff with a longer Retry-After = %v, want 1m", d)
+	}
+}
+
+// statusServer answers each request with the next status of statuses,
+// repeating the last, and counts the requests.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := statuses[min(calls, len(statuses)-1)]
+		calls++
+		mu.Unlock()
+		if status == http.StatusTooManyRequests && retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestPerformRequestRetries(t *testing.T) {
+	const path = "/market/stats"
+	tests := []struct {
+		name       string
+		method     string
+		retryAfter string
+		statuses   []int
+		wantErr    bool
+		wantCalls  int
+		wantSleeps int
+		minSleep   time.Duration // shortest backoff expected, 0 for any
+	}{
+		{"429 then success", http.MethodGet, "2", []int{429, 429, 200}, false, 3, 2, 2 * time.Second},
+		{"429 gives up after the retries", http.MethodGet, "", []int{429}, true, maxRequestRetries + 1, maxRequestRetries, 0},
+		{"GET retried on server error", http.MethodGet, "", []int{502, 200}, false, 2, 1, 0},
+		{"POST not retried on server error", http.MethodPost, "", []int{502, 200}, true, 1, 0, 0},
+		{"POST retried on 429", http.MethodPost, "1", []int{429, 200}, false, 2, 1, time.Second},
+		{"client error not retried", http.MethodGet, "", []int{400, 200}, true, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := statusServer(t, tt.retryAfter, tt.statuses...)
+			clock := newFakeClock()
+			c := &Client{BaseURL: srv.URL, Limiter: clock.limiter(nil)}
+
+			_, err := c.performRequest(context.Background(), tt.method, path, map[string]string{}, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", *calls, tt.wantCalls)
+			}
+			slept := clock.takeSlept()
+			if len(slept) != tt.wantSleeps {
+				t.Fatalf("slept %v, want %d backoffs", slept, tt.wantSleeps)
+			}
+			for i, d := range slept {
+				full := min(baseRetryDelay<<i, maxBackoffDelay)
+				if d < max(full/2, tt.minSleep) || d > max(full, tt.minSleep) {
+					t.Errorf("backoff %d = %v, want within [%v, %v] and at least %v", i+1, d, full/2, full, tt.minSleep)
+				}
+			}
+		})
+	}
+}
+
+func TestPerformRequestStopsOnCancel(t *testing.T) {
+	srv, calls := statusServer(t, "", http.StatusTooManyRequests)
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{BaseURL: srv.URL, Limiter: newRateLimiter(nil, clock.now, func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	})}
+	if _, err := c.performRequest(ctx, http.MethodGet, "/market/stats", nil, false); !IsRateLimited(err) {
+		t.Fatalf("err = %v, want the 429", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
@@ -0,0 +1,289 @@
+package nobitex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/centrifuge-go"
+)
+
+// StreamHandlers are the callbacks invoked by a WebSocket subscription.
+// Any of them may be nil. The trades channel is only subscribed when OnTrade
+// is set, and the candle channel when OnCandle and CandleResolution are.
+type StreamHandlers struct {
+	OnConnected    func()
+	OnDisconnected func(reason string)
+	OnSubscribed   func(channel string, recovered bool) // also after the client resubscribes on its own
+	OnError        func(err error)
+	OnOrderBook    func(book OrderBook)
+	OnTrade        func(trade Trade)
+	OnCandle       func(candle Candle) // the current bar, sent again as it changes
+
+	CandleResolution string // in the /market/udf/history notation, e.g. "1" or "60"
+}
+
+// SubscribeMarket connects to the public WebSocket and streams currencyPair's
+// order book snapshots, and optionally its trades and candles, to handlers
+// until ctx is cancelled. All channels share one connection, which is
+// re-established and resubscribed after network failures; to force a fresh
+// connection, cancel ctx and subscribe again.
+func (c *Client) SubscribeMarket(ctx context.Context, currencyPair string, handlers StreamHandlers) error {
+	market, err := ParseMarket(currencyPair)
+	if err != nil {
+		return err
+	}
+	channels := map[string]func(data []byte) error{
+		market.OrderBookChannel(): func(data []byte) error {
+			var raw rawOrderBook
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("error parsing orderBook data: %w", err)
+			}
+			if handlers.OnOrderBook != nil {
+				book := OrderBook{
+					Asks: parseOrderBook(raw.Asks),
+					Bids: parseOrderBook(raw.Bids),
+				}
+				if raw.LastUpdate > 0 {
+					book.UpdatedAt = time.UnixMilli(raw.LastUpdate)
+				}
+				handlers.OnOrderBook(book)
+			}
+			return nil
+		},
+	}
+	if handlers.OnTrade != nil {
+		channels[market.TradesChannel()] = func(data []byte) error {
+			trades, err := decodeTrades(data)
+			if err != nil {
+				return fmt.Errorf("error parsing trades data: %w", err)
+			}
+			for _, t := range trades {
+				handlers.OnTrade(t)
+			}
+			return nil
+		}
+	}
+	if handlers.OnCandle != nil && handlers.CandleResolution != "" {
+		if _, err := ResolutionDuration(handlers.CandleResolution); err != nil {
+			return err
+		}
+		channels[market.CandleChannel(handlers.CandleResolution)] = func(data []byte) error {
+			candle, err := decodeCandle(data)
+			if err != nil {
+				return fmt.Errorf("error parsing candle data: %w", err)
+			}
+			handlers.OnCandle(candle)
+			return nil
+		}
+	}
+
+	hooks := streamHooks{
+		onConnected:    handlers.OnConnected,
+		onDisconnected: handlers.OnDisconnected,
+		onSubscribed:   handlers.OnSubscribed,
+		onError:        handlers.OnError,
+	}
+	return c.stream(ctx, centrifuge.Config{}, channels, hooks)
+}
+
+// StreamError is a failure of one channel's subscription, passed to the
+// OnError handlers.
+type StreamError struct {
+	Channel string
+	Err     error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("subscription error on %s: %v", e.Channel, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// streamHooks are the connection callbacks shared by public and private
+// subscriptions.
+type streamHooks struct {
+	onConnected    func()
+	onDisconnected func(reason string)
+	onSubscribed   func(channel string, recovered bool)
+	onError        func(err error)
+}
+
+// stream opens one WebSocket connection, subscribes to channels, each with
+// the function decoding its publications, and closes the connection when ctx
+// is cancelled. On error the connection is closed before returning.
+func (c *Client) stream(ctx context.Context, config centrifuge.Config, channels map[string]func(data []byte) error, hooks streamHooks) (err error) {
+	url := c.StreamURL
+	if url == "" {
+		url = DefaultStreamURL
+	}
+	client := centrifuge.NewJsonClient(url, config)
+	defer func() {
+		if err != nil {
+			client.Close()
+		}
+	}()
+
+	client.OnConnected(func(_ centrifuge.ConnectedEvent) {
+		if hooks.onConnected != nil {
+			hooks.onConnected()
+		}
+	})
+	client.OnDisconnected(func(e centrifuge.DisconnectedEvent) {
+		if hooks.onDisconnected != nil {
+			hooks.onDisconnected(e.Reason)
+		}
+	})
+
+	for channel, decode := range channels {
+		sub, err := client.NewSubscription(channel)
+		if err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+		sub.OnSubscribed(func(e centrifuge.SubscribedEvent) {
+			if hooks.onSubscribed != nil {
+				hooks.onSubscribed(channel, e.Recovered)
+			}
+		})
+		sub.OnError(func(e centrifuge.SubscriptionErrorEvent) {
+			if hooks.onError != nil {
+				hooks.onError(&StreamError{Channel: channel, Err: e.Error})
+			}
+		})
+		sub.OnPublication(func(event centrifuge.PublicationEvent) {
+			if err := decode(event.Data); err != nil && hooks.onError != nil {
+				hooks.onError(err)
+			}
+		})
+		if err := sub.Subscribe(); err != nil {
+			return fmt.Errorf("failed to subscribe to WS channel: %w", err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to WS: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		client.Close()
+	}()
+	return nil
+}
+
+func parseOrderBook(raw [][]string) [][2]float64 {
+	var result [][2]float64
+	for _, entry := range raw {
+		if len(entry) < 2 {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(entry[0], 64)
+		amount, err2 := strconv.ParseFloat(entry[1], 64)
+		if err1 == nil && err2 == nil {
+			result = append(result, [2]float64{price, amount})
+		}
+	}
+	return result
+}
+
+// Trade is one public trade. Side is the aggressor's: "buy" when a buyer
+// took an ask, "sell" when a seller hit a bid.
+type Trade struct {
+	Time   time.Time
+	Price  float64
+	Volume float64
+	Side   string
+}
+
+// number decodes a JSON number sent either bare or as a string.
+type number float64
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	*n = number(v)
+	return err
+}
+
+type rawTrade struct {
+	Time   int64  `json:"time"` // unix milliseconds
+	Price  number `json:"price"`
+	Volume number `json:"volume"`
+	Type   string `json:"type"`
+}
+
+// decodeTrades reads a trades publication, which carries one trade, a list
+// of them or an object with a "trades" list, oldest first.
+func decodeTrades(data []byte) ([]Trade, error) {
+	var raws []rawTrade
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return nil, err
+		}
+	} else {
+		var doc struct {
+			rawTrade
+			Trades *[]rawTrade `json:"trades"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Trades != nil {
+			raws = *doc.Trades
+		} else {
+			raws = []rawTrade{doc.rawTrade}
+		}
+	}
+
+	trades := make([]Trade, 0, len(raws))
+	for _, r := range raws {
+		if r.Price <= 0 {
+			continue
+		}
+		trades = append(trades, Trade{
+			Time:   time.UnixMilli(r.Time),
+			Price:  float64(r.Price),
+			Volume: float64(r.Volume),
+			Side:   strings.ToLower(r.Type),
+		})
+	}
+	return trades, nil
+}
+
+// decodeCandle reads a candle publication, whose time is the bar's open time
+// in unix seconds.
+func decodeCandle(data []byte) (Candle, error) {
+	var raw struct {
+		Time   int64  `json:"t"`
+		Open   number `json:"o"`
+		High   number `json:"h"`
+		Low    number `json:"l"`
+		Close  number `json:"c"`
+		Volume number `json:"v"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Candle{}, err
+	}
+	if raw.Time == 0 || raw.Close <= 0 {
+		return Candle{}, fmt.Errorf("incomplete candle: %s", data)
+	}
+	return Candle{
+		Time:   time.Unix(raw.Time, 0),
+		Open:   float64(raw.Open),
+		High:   float64(raw.High),
+		Low:    float64(raw.Low),
+		Close:  float64(raw.Close),
+		Volume: float64(raw.Volume),
+	}, nil
+}
@@ -0,0 +1,180 @@
+package nobitex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNumberUnmarshal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{`12.5`, 12.5, false},
+		{`"12.5"`, 12.5, false},
+		{`"8000000000"`, 8e9, false},
+		{`0`, 0, false},
+		{`""`, 0, false},
+		{`null`, 0, false},
+		{`"abc"`, 0, true},
+	}
+	for _, tt := range tests {
+		var n number
+		err := json.Unmarshal([]byte(tt.in), &n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && float64(n) != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.in, float64(n), tt.want)
+		}
+	}
+}
+
+func TestDecodeTrades(t *testing.T) {
+	first := Trade{Time: time.UnixMilli(1699356578813), Price: 8000000000, Volume: 0.01, Side: "sell"}
+	second := Trade{Time: time.UnixMilli(1699356579001), Price: 8000100000, Volume: 0.25, Side: "buy"}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []Trade
+		wantErr bool
+	}{
+		{
+			name: "single trade",
+			data: `{"price":"8000000000","volume":"0.01","time":1699356578813,"type":"sell"}`,
+			want: []Trade{first},
+		},
+		{
+			name: "list",
+			data: ` [{"price":"8000000000","volume":"0.01","time":1699356578813,"type":"sell"},
+				{"price":8000100000,"volume":0.25,"time":1699356579001,"type":"BUY"}]`,
+			want: []Trade{first, second},
+		},
+		{
+			name: "wrapped list",
+			data: `{"trades":[{"price":"8000000000","volume":"0.01","time":1699356578813,"type":"sell"},
+				{"price":"8000100000","volume":"0.25","time":1699356579001,"type":"buy"}]}`,
+			want: []Trade{first, second},
+		},
+		{
+			name: "empty wrapped list",
+			data: `{"trades":[]}`,
+			want: []Trade{},
+		},
+		{
+			name: "trades text inside a field",
+			data: `{"price":"8000000000","volume":"0.01","time":1699356578813,"type":"sell","note":"\"trades\""}`,
+			want: []Trade{first},
+		},
+		{
+			name: "priceless entries dropped",
+			data: `[{"price":"0","volume":"1","time":1,"type":"buy"},{"price":"8000000000","volume":"0.01","time":1699356578813,"type":"sell"}]`,
+			want: []Trade{first},
+		},
+		{
+			name:    "bad number",
+			data:    `{"price":"x","volume":"0.01","time":1,"type":"sell"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			data:    `trades`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeTrades([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Candle
+		wantErr bool
+	}{
+		{
+			name: "string numbers",
+			data: `{"t":1699356540,"o":"8000000000","h":"8001000000","l":"7999000000","c":"8000500000","v":"1.5"}`,
+			want: Candle{Time: time.Unix(1699356540, 0), Open: 8e9, High: 8.001e9, Low: 7.999e9, Close: 8.0005e9, Volume: 1.5},
+		},
+		{
+			name: "bare numbers",
+			data: `{"t":1699356600,"o":61000.5,"h":61010,"l":60990,"c":61005,"v":0}`,
+			want: Candle{Time: time.Unix(1699356600, 0), Open: 61000.5, High: 61010, Low: 60990, Close: 61005},
+		},
+		{
+			name:    "no time",
+			data:    `{"o":"1","h":"1","l":"1","c":"1","v":"1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no close",
+			data:    `{"t":1699356540,"o":"1","h":"1","l":"1","v":"1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "list instead of object",
+			data:    `[1699356540,1,1,1,1,1]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCandle([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// settledGoroutines waits for the goroutine count to drop to at most want and
+// returns the last count seen.
+func settledGoroutines(want int) int {
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(5 * time.Second); n > want && time.Now().Before(deadline); n = runtime.NumGoroutine() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return n
+}
+
+func TestStreamClosesClientOnError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	c := &Client{StreamURL: "ws" + strings.TrimPrefix(srv.URL, "http")}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	base := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		if err := c.SubscribeMarket(ctx, "BTCIRT", StreamHandlers{OnOrderBook: func(OrderBook) {}}); err == nil {
+			t.Fatal("subscribed with a cancelled context")
+		}
+	}
+	if n := settledGoroutines(base); n > base {
+		t.Errorf("goroutines grew from %d to %d over failed subscriptions", base, n)
+	}
+}
@@ -0,0 +1,452 @@
+package paper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// MarketData is the live feed the simulated account trades against.
+// *nobitex.Client satisfies it without a token.
+type MarketData interface {
+	GetOHLCVData(ctx context.Context, symbol, resolution string, from, to int64) ([]nobitex.Candle, error)
+	SubscribeMarket(ctx context.Context, currencyPair string, handlers nobitex.StreamHandlers) error
+	GetMarkets(ctx context.Context) (map[string]nobitex.MarketInfo, error)
+}
+
+// Config sets up the virtual account.
+type Config struct {
+	Balance float64        // starting balance of each margin wallet (RLS, USDT, ...)
+	FeeRate float64        // charged on the notional of every fill
+	Logger  *logrus.Logger // optional; receives fills and position changes
+}
+
+// Exchange is an in-process margin account that consumes real market data but
+// answers order, position and balance calls itself. Limit orders fill against
+// the live order book of their pair as it streams in. One Exchange can serve
+// several pairs, those quoted in the same currency sharing a virtual wallet.
+type Exchange struct {
+	market MarketData
+	cfg    Config
+
+	mu        sync.Mutex
+	balances  map[string]float64           // by lowercase dst currency
+	books     map[string]nobitex.OrderBook // by upper-case pair
+	nextID    int
+	orders    map[int]*order
+	positions map[int]*position
+	feeds     map[chan accountEvent]struct{} // private stream subscribers
+}
+
+type order struct {
+	id         int
+	pair       string
+	src        string
+	dst        string
+	side       string
+	leverage   float64
+	price      float64
+	amount     float64
+	matched    float64
+	status     string // Active, Inactive (untriggered stop), Done, Canceled
+	resting    bool   // false until it has been checked against a book once
+	positionID int    // set on orders closing a position
+	stopPrice  float64
+	siblingID  int // the other leg of an OCO
+}
+
+type position struct {
+	id         int
+	pair       string
+	src        string
+	dst        string
+	side       string
+	leverage   float64
+	entryPrice float64
+	liability  float64 // open amount in src currency
+	collateral float64 // margin locked in dst currency
+	exitValue  float64 // sum of closed amount * exit price
+	exitAmount float64
+	realized   float64
+	status     string // Open, Closed, Liquidated
+	openedAt   time.Time
+	closedAt   time.Time
+}
+
+// New creates a paper exchange on top of market.
+func New(market MarketData, cfg Config) *Exchange {
+	return &Exchange{
+		market:    market,
+		cfg:       cfg,
+		balances:  make(map[string]float64),
+		books:     make(map[string]nobitex.OrderBook),
+		orders:    make(map[int]*order),
+		positions: make(map[int]*position),
+		feeds:     make(map[chan accountEvent]struct{}),
+	}
+}
+
+// rejected returns the error Nobitex would give for a call it refused.
+func rejected(op, code, format string, args ...interface{}) error {
+	return &nobitex.APIError{Op: op, HTTPStatus: http.StatusOK, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// GetAvailableBalance returns the virtual balance of the currency wallet
+// minus margin locked in positions and reserved by open entry orders.
+func (e *Exchange) GetAvailableBalance(ctx context.Context, currency string) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.available(strings.ToLower(currency)), nil
+}
+
+func (e *Exchange) available(dst string) float64 {
+	blocked := 0.0
+	for _, p := range e.positions {
+		if p.status == "Open" && p.dst == dst {
+			blocked += p.collateral
+		}
+	}
+	for _, o := range e.orders {
+		if o.positionID == 0 && o.status == "Active" && o.dst == dst {
+			blocked += (o.amount - o.matched) * o.price / o.leverage
+		}
+	}
+	return e.balance(dst) - blocked
+}
+
+// balance is the dst wallet's balance; wallets start at Config.Balance.
+func (e *Exchange) balance(dst string) float64 {
+	if b, ok := e.balances[dst]; ok {
+		return b
+	}
+	return e.cfg.Balance
+}
+
+// credit adds v, which may be negative, to the dst wallet.
+func (e *Exchange) credit(dst string, v float64) {
+	e.balances[dst] = e.balance(dst) + v
+}
+
+// PlaceMarginOrder opens a simulated margin limit order.
+func (e *Exchange) PlaceMarginOrder(ctx context.Context, currencyPair, leverage, orderType string, amount, price float64) (int, error) {
+	src, dst, err := nobitex.SplitCurrencyPair(currencyPair)
+	if err != nil {
+		return 0, err
+	}
+	if orderType != "buy" && orderType != "sell" {
+		return 0, fmt.Errorf("invalid order type: %s", orderType)
+	}
+	lev, err := strconv.ParseFloat(leverage, 64)
+	if err != nil || lev < 1 {
+		return 0, fmt.Errorf("invalid leverage: %s", leverage)
+	}
+	if amount <= 0 || price <= 0 {
+		return 0, fmt.Errorf("invalid amount or price: amount=%v price=%v", amount, price)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if amount*price/lev > e.available(dst) {
+		return 0, rejected("place "+orderType+" order", "InsufficientBalance", "paper balance too low")
+	}
+	o := e.newOrder(strings.ToUpper(currencyPair), src, dst, orderType, amount, price)
+	o.leverage = lev
+	e.logOrder(o, "Paper order placed")
+	e.publishOrder(o)
+	e.match(o.pair)
+	return o.id, nil
+}
+
+// CancelOrder cancels an open order; cancelling either OCO leg cancels both.
+func (e *Exchange) CancelOrder(ctx context.Context, orderID int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return rejected("cancel", "NotFound", "order %d not found", orderID)
+	}
+	if o.status != "Active" && o.status != "Inactive" {
+		return rejected("cancel", "InvalidStatus", "order %d is %s", orderID, o.status)
+	}
+	e.cancel(o)
+	if sibling, ok := e.orders[o.siblingID]; ok {
+		e.cancel(sibling)
+	}
+	return nil
+}
+
+// CheckOrderStatus returns an order's status and matched amount.
+func (e *Exchange) CheckOrderStatus(ctx context.Context, orderID int) (string, float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return "", 0, rejected(fmt.Sprintf("check order %d", orderID), "NotFound", "order %d not found", orderID)
+	}
+	return o.status, o.matched, nil
+}
+
+// GetOpenMarginOrders lists the open orders on currencyPair, oldest first.
+func (e *Exchange) GetOpenMarginOrders(ctx context.Context, currencyPair string) ([]nobitex.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	pair := strings.ToUpper(currencyPair)
+	var result []nobitex.Order
+	for _, o := range e.orders {
+		if o.pair != pair || (o.status != "Active" && o.status != "Inactive") {
+			continue
+		}
+		execution := "limit"
+		if o.stopPrice > 0 {
+			execution = "stop_limit"
+		}
+		result = append(result, nobitex.Order{
+			ID:              o.id,
+			Type:            o.side,
+			Execution:       execution,
+			TradeType:       "margin",
+			SrcCurrency:     o.src,
+			DstCurrency:     o.dst,
+			Price:           format(o.price),
+			Amount:          format(o.amount),
+			MatchedAmount:   format(o.matched),
+			UnmatchedAmount: format(o.amount - o.matched),
+			Status:          o.status,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// GetOpenPositions lists open positions for srcCurrency, only those quoted in
+// dstCurrency when it is set.
+func (e *Exchange) GetOpenPositions(ctx context.Context, srcCurrency, dstCurrency string) ([]nobitex.Position, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var result []nobitex.Position
+	for _, p := range e.positions {
+		if p.status == "Open" && p.src == strings.ToLower(srcCurrency) &&
+			(dstCurrency == "" || p.dst == strings.ToLower(dstCurrency)) {
+			result = append(result, e.toPosition(p))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// GetPositionDetails returns a position by ID, open or not.
+func (e *Exchange) GetPositionDetails(ctx context.Context, positionID int) (*nobitex.Position, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.positions[positionID]
+	if !ok {
+		return nil, rejected(fmt.Sprintf("fetch position %d details", positionID), "NotFound", "position %d not found", positionID)
+	}
+	pos := e.toPosition(p)
+	return &pos, nil
+}
+
+// ClosePositionOCO places a take-profit limit and a stop-limit closing amount
+// of the position. Only liability not already in a close order can be used.
+func (e *Exchange) ClosePositionOCO(ctx context.Context, positionID int, amount, takeProfitPrice, stopPrice, stopLimitPrice float64) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.positions[positionID]
+	if !ok || p.status != "Open" {
+		return 0, rejected(fmt.Sprintf("close position %d", positionID), "InvalidPosition", "position is not open")
+	}
+	if free := p.liability - e.liabilityInOrder(p.id); amount > free*(1+1e-9) {
+		return 0, rejected(fmt.Sprintf("close position %d", positionID), "ExceedLiability", "amount %v exceeds free liability %v", amount, free)
+	}
+
+	side := "sell"
+	if p.side == "sell" {
+		side = "buy"
+	}
+	tp := e.newOrder(p.pair, p.src, p.dst, side, amount, takeProfitPrice)
+	tp.positionID = p.id
+	sl := e.newOrder(p.pair, p.src, p.dst, side, amount, stopLimitPrice)
+	sl.positionID = p.id
+	sl.stopPrice = stopPrice
+	sl.status = "Inactive"
+	tp.siblingID, sl.siblingID = sl.id, tp.id
+
+	e.logOrder(tp, "Paper OCO placed")
+	e.publishOrder(tp)
+	e.publishOrder(sl)
+	e.match(p.pair)
+	return tp.id, nil
+}
+
+// ClosePosition places a limit order closing amount of the position at price.
+func (e *Exchange) ClosePosition(ctx context.Context, positionID int, amount, price float64) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.positions[positionID]
+	if !ok || p.status != "Open" {
+		return 0, rejected(fmt.Sprintf("close position %d", positionID), "InvalidPosition", "position is not open")
+	}
+	if free := p.liability - e.liabilityInOrder(p.id); amount > free*(1+1e-9) {
+		return 0, rejected(fmt.Sprintf("close position %d", positionID), "ExceedLiability", "amount %v exceeds free liability %v", amount, free)
+	}
+
+	side := "sell"
+	if p.side == "sell" {
+		side = "buy"
+	}
+	o := e.newOrder(p.pair, p.src, p.dst, side, amount, price)
+	o.positionID = p.id
+
+	e.logOrder(o, "Paper close order placed")
+	e.publishOrder(o)
+	e.match(p.pair)
+	return o.id, nil
+}
+
+// GetOHLCVData passes through to the live market data.
+func (e *Exchange) GetOHLCVData(ctx context.Context, symbol, resolution string, from, to int64) ([]nobitex.Candle, error) {
+	return e.market.GetOHLCVData(ctx, symbol, resolution, from, to)
+}
+
+// GetMarkets passes through to the live market rules.
+func (e *Exchange) GetMarkets(ctx context.Context) (map[string]nobitex.MarketInfo, error) {
+	return e.market.GetMarkets(ctx)
+}
+
+// SubscribeMarket streams the live market data, matching resting paper orders
+// against every order book snapshot before handing it on.
+func (e *Exchange) SubscribeMarket(ctx context.Context, currencyPair string, handlers nobitex.StreamHandlers) error {
+	pair := strings.ToUpper(currencyPair)
+	onBook := handlers.OnOrderBook
+	handlers.OnOrderBook = func(book nobitex.OrderBook) {
+		e.mu.Lock()
+		e.books[pair] = book
+		e.match(pair)
+		e.mu.Unlock()
+		if onBook != nil {
+			onBook(book)
+		}
+	}
+	return e.market.SubscribeMarket(ctx, currencyPair, handlers)
+}
+
+func (e *Exchange) newOrder(pair, src, dst, side string, amount, price float64) *order {
+	e.nextID++
+	o := &order{
+		id:     e.nextID,
+		pair:   pair,
+		src:    src,
+		dst:    dst,
+		side:   side,
+		price:  price,
+		amount: amount,
+		status: "Active",
+	}
+	e.orders[o.id] = o
+	return o
+}
+
+func (e *Exchange) cancel(o *order) {
+	if o.status == "Active" || o.status == "Inactive" {
+		o.status = "Canceled"
+		e.logOrder(o, "Paper order canceled")
+		e.publishOrder(o)
+	}
+}
+
+// liabilityInOrder sums the unfilled amount of live close orders for a
+// position, counting each OCO pair once.
+func (e *Exchange) liabilityInOrder(positionID int) float64 {
+	total := 0.0
+	for _, o := range e.orders {
+		if o.positionID != positionID || (o.status != "Active" && o.status != "Inactive") {
+			continue
+		}
+		if sibling, ok := e.orders[o.siblingID]; ok && sibling.id < o.id &&
+			(sibling.status == "Active" || sibling.status == "Inactive") {
+			continue
+		}
+		total += o.amount - o.matched
+	}
+	return total
+}
+
+func (e *Exchange) toPosition(p *position) nobitex.Position {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	mark := e.markPrice(p.pair)
+	unrealized := 0.0
+	if mark > 0 && p.status == "Open" {
+		unrealized = p.direction() * p.liability * (mark - p.entryPrice)
+	}
+
+	pos := nobitex.Position{
+		ID:               p.id,
+		CreatedAt:        p.openedAt.Format(time.RFC3339),
+		SrcCurrency:      p.src,
+		DstCurrency:      p.dst,
+		Side:             p.side,
+		Status:           p.status,
+		MarginType:       "Isolated Margin",
+		Collateral:       format(p.collateral),
+		Leverage:         format(p.leverage),
+		OpenedAt:         p.openedAt.Format(time.RFC3339),
+		LiquidationPrice: format(p.liquidationPrice()),
+		EntryPrice:       format(p.entryPrice),
+		Liability:        format(p.liability),
+		TotalAsset:       format(p.liability * p.entryPrice),
+		LiabilityInOrder: format(e.liabilityInOrder(p.id)),
+		UnrealizedPNL:    format(unrealized),
+		MarkPrice:        format(mark),
+	}
+	if p.collateral > 0 {
+		pos.MarginRatio = format((p.collateral + unrealized) / p.collateral)
+		pos.UnrealizedPNLPercent = format(unrealized / p.collateral * 100)
+	}
+	if !p.closedAt.IsZero() {
+		closedAt := p.closedAt.Format(time.RFC3339)
+		pos.ClosedAt = &closedAt
+	}
+	if p.status != "Open" {
+		pnl := format(p.realized)
+		pos.PNL = &pnl
+	}
+	if p.exitAmount > 0 {
+		exitPrice := format(p.exitValue / p.exitAmount)
+		pos.ExitPrice = &exitPrice
+	}
+	return pos
+}
+
+func (e *Exchange) logOrder(o *order, msg string) {
+	if e.cfg.Logger == nil {
+		return
+	}
+	e.cfg.Logger.WithFields(logrus.Fields{
+		"order_id":    o.id,
+		"pair":        o.pair,
+		"side":        o.side,
+		"price":       o.price,
+		"stop_price":  o.stopPrice,
+		"amount":      o.amount,
+		"matched":     o.matched,
+		"status":      o.status,
+		"position_id": o.positionID,
+	}).Info(msg)
+}
@@ -0,0 +1,217 @@
+package paper
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+const dust = 1e-12
+
+// match fills pair's resting orders that its current book trades through,
+// triggers stops and liquidates positions past their liquidation price.
+// Callers hold e.mu.
+func (e *Exchange) match(pair string) {
+	book := e.books[pair]
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return
+	}
+
+	ids := make([]int, 0, len(e.orders))
+	for id, o := range e.orders {
+		if o.pair == pair && (o.status == "Active" || o.status == "Inactive") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		o := e.orders[id]
+		if o.status == "Inactive" {
+			if !stopTriggered(o, book) {
+				continue
+			}
+			o.status = "Active"
+			e.logOrder(o, "Paper stop triggered")
+			e.publishOrder(o)
+			if sibling, ok := e.orders[o.siblingID]; ok {
+				e.cancel(sibling)
+			}
+		}
+		if o.status != "Active" {
+			continue
+		}
+		e.fill(o, book)
+	}
+
+	for _, p := range e.positions {
+		if p.pair == pair && p.status == "Open" && pastLiquidation(p, book) {
+			e.liquidate(p)
+		}
+	}
+}
+
+func stopTriggered(o *order, book nobitex.OrderBook) bool {
+	if o.side == "sell" {
+		return book.Bids[0][0] <= o.stopPrice
+	}
+	return book.Asks[0][0] >= o.stopPrice
+}
+
+// fill matches o against the opposite side of the book. An order that crosses
+// on arrival takes the book's prices; a resting order fills at its own limit
+// once the book trades through it.
+func (e *Exchange) fill(o *order, book nobitex.OrderBook) {
+	levels := book.Asks
+	crosses := func(price float64) bool { return price <= o.price }
+	if o.side == "sell" {
+		levels = book.Bids
+		crosses = func(price float64) bool { return price >= o.price }
+	}
+
+	for _, level := range levels {
+		remaining := o.amount - o.matched
+		if remaining <= dust || !crosses(level[0]) {
+			break
+		}
+		price := o.price
+		if !o.resting {
+			price = level[0]
+		}
+		e.applyFill(o, min(remaining, level[1]), price)
+	}
+	o.resting = true
+
+	if o.amount-o.matched <= dust {
+		o.status = "Done"
+		e.logOrder(o, "Paper order filled")
+		e.publishOrder(o)
+	}
+}
+
+func (e *Exchange) applyFill(o *order, amount, price float64) {
+	if amount <= 0 {
+		return
+	}
+	o.matched += amount
+	e.credit(o.dst, -amount*price*e.cfg.FeeRate)
+	e.publishTrade(o, amount, price)
+
+	if o.positionID == 0 {
+		e.openPosition(o, amount, price)
+		return
+	}
+
+	p, ok := e.positions[o.positionID]
+	if !ok || p.status != "Open" {
+		return
+	}
+	// The first fill of one OCO leg cancels the other.
+	if sibling, ok := e.orders[o.siblingID]; ok {
+		e.cancel(sibling)
+	}
+	amount = min(amount, p.liability)
+	share := amount / p.liability
+	pnl := p.direction() * amount * (price - p.entryPrice)
+	e.credit(p.dst, pnl)
+	p.realized += pnl
+	p.collateral -= p.collateral * share
+	p.liability -= amount
+	p.exitValue += amount * price
+	p.exitAmount += amount
+
+	if p.liability <= dust {
+		p.liability = 0
+		p.status = "Closed"
+		p.closedAt = time.Now()
+	}
+	e.logPosition(p, "Paper position reduced")
+}
+
+// openPosition creates the position backing an entry order on its first fill
+// and grows it on later fills. Positions are keyed by the entry order's ID.
+func (e *Exchange) openPosition(o *order, amount, price float64) {
+	p, ok := e.positions[o.id]
+	if !ok {
+		p = &position{
+			id:       o.id,
+			pair:     o.pair,
+			src:      o.src,
+			dst:      o.dst,
+			side:     o.side,
+			leverage: o.leverage,
+			status:   "Open",
+			openedAt: time.Now(),
+		}
+		e.positions[p.id] = p
+	}
+	p.entryPrice = (p.entryPrice*p.liability + price*amount) / (p.liability + amount)
+	p.liability += amount
+	p.collateral += amount * price / o.leverage
+	e.logPosition(p, "Paper position opened")
+}
+
+func pastLiquidation(p *position, book nobitex.OrderBook) bool {
+	if p.side == "buy" {
+		return book.Bids[0][0] <= p.liquidationPrice()
+	}
+	return book.Asks[0][0] >= p.liquidationPrice()
+}
+
+// liquidate closes p at its liquidation price, forfeiting the collateral.
+func (e *Exchange) liquidate(p *position) {
+	for _, o := range e.orders {
+		if o.positionID == p.id {
+			e.cancel(o)
+		}
+	}
+	price := p.liquidationPrice()
+	e.credit(p.dst, -p.collateral)
+	p.realized -= p.collateral
+	p.exitValue += p.liability * price
+	p.exitAmount += p.liability
+	p.collateral = 0
+	p.liability = 0
+	p.status = "Liquidated"
+	p.closedAt = time.Now()
+	e.logPosition(p, "Paper position liquidated")
+}
+
+func (p *position) direction() float64 {
+	if p.side == "sell" {
+		return -1
+	}
+	return 1
+}
+
+// liquidationPrice is where the loss equals the locked collateral.
+func (p *position) liquidationPrice() float64 {
+	return p.entryPrice * (1 - p.direction()/p.leverage)
+}
+
+func (e *Exchange) markPrice(pair string) float64 {
+	book := e.books[pair]
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0
+	}
+	return (book.Bids[0][0] + book.Asks[0][0]) / 2
+}
+
+func (e *Exchange) logPosition(p *position, msg string) {
+	if e.cfg.Logger == nil {
+		return
+	}
+	e.cfg.Logger.WithFields(logrus.Fields{
+		"position_id": p.id,
+		"pair":        p.pair,
+		"side":        p.side,
+		"entry_price": p.entryPrice,
+		"liability":   p.liability,
+		"collateral":  p.collateral,
+		"realized":    p.realized,
+		"status":      p.status,
+		"balance":     e.balance(p.dst),
+	}).Info(msg)
+}
@@ -0,0 +1,102 @@
+package paper
+
+import (
+	"context"
+	"time"
+
+	"nobitex-sma-bot/internal/nobitex"
+)
+
+// feedBuffer is how many events a private stream subscriber may fall behind
+// by; later events are dropped, as a lagging WebSocket would lose them.
+const feedBuffer = 256
+
+// accountEvent is an order update or a fill, as the private channels carry them.
+type accountEvent struct {
+	order *nobitex.OrderEvent
+	trade *nobitex.UserTrade
+}
+
+// SubscribePrivate streams the paper account's order updates and fills to
+// handlers until ctx is cancelled, like the private WebSocket channels.
+func (e *Exchange) SubscribePrivate(ctx context.Context, handlers nobitex.PrivateHandlers) error {
+	feed := make(chan accountEvent, feedBuffer)
+	e.mu.Lock()
+	e.feeds[feed] = struct{}{}
+	e.mu.Unlock()
+
+	if handlers.OnConnected != nil {
+		handlers.OnConnected()
+	}
+	if handlers.OnSubscribed != nil {
+		handlers.OnSubscribed("private:orders#paper", false)
+		handlers.OnSubscribed("private:trades#paper", false)
+	}
+	go func() {
+		defer func() {
+			e.mu.Lock()
+			delete(e.feeds, feed)
+			e.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-feed:
+				switch {
+				case ev.order != nil && handlers.OnOrder != nil:
+					handlers.OnOrder(*ev.order)
+				case ev.trade != nil && handlers.OnTrade != nil:
+					handlers.OnTrade(*ev.trade)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// publishOrder sends o's current state to the private stream subscribers.
+// Callers hold e.mu.
+func (e *Exchange) publishOrder(o *order) {
+	execution := "Limit"
+	if o.stopPrice > 0 {
+		execution = "StopLimit"
+	}
+	e.publish(accountEvent{order: &nobitex.OrderEvent{
+		OrderID:     o.id,
+		SrcCurrency: o.src,
+		DstCurrency: o.dst,
+		Side:        o.side,
+		Execution:   execution,
+		TradeType:   "Margin",
+		Status:      o.status,
+		Price:       o.price,
+		Amount:      o.amount,
+		Matched:     o.matched,
+		Time:        time.Now(),
+	}})
+}
+
+// publishTrade sends a fill of o to the private stream subscribers. Callers
+// hold e.mu.
+func (e *Exchange) publishTrade(o *order, amount, price float64) {
+	e.publish(accountEvent{trade: &nobitex.UserTrade{
+		OrderID:     o.id,
+		SrcCurrency: o.src,
+		DstCurrency: o.dst,
+		Side:        o.side,
+		Price:       price,
+		Amount:      amount,
+		Fee:         amount * price * e.cfg.FeeRate,
+		Time:        time.Now(),
+	}})
+}
+
+func (e *Exchange) publish(ev accountEvent) {
+	for feed := range e.feeds {
+		select {
+		case feed <- ev:
+		default:
+		}
+	}
+}
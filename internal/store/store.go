@@ -0,0 +1,263 @@
+// Package store persists the bot's trading state in an embedded bbolt
+// database, so a restart does not forget which positions already have exit
+// orders or which entry orders were still working.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	positionsBucket   = []byte("positions")
+	entryOrdersBucket = []byte("entry_orders")
+	stateBucket       = []byte("state")
+	guardBucket       = []byte("guard")
+
+	guardKey = []byte("account")
+)
+
+// PositionRecord remembers the exit orders working on an open position.
+type PositionRecord struct {
+	Pair       string       `json:"pair"`
+	PositionID int          `json:"position_id"`
+	Side       string       `json:"side"`
+	Exits      []ExitRecord `json:"exits"`
+	BreakEven  bool         `json:"break_even,omitempty"` // stops already moved to break-even
+	Stop       float64      `json:"stop,omitempty"`       // last stop the exits were moved to
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// legacyPositionRecord reads records written before exits were split into
+// tranches, which listed the close orders' IDs with one set of prices.
+type legacyPositionRecord struct {
+	PositionRecord
+	CloseOrderIDs []int   `json:"close_order_ids"`
+	TakeProfit    float64 `json:"take_profit"`
+	StopLoss      float64 `json:"stop_loss"`
+}
+
+// upgrade converts the old close order IDs into exits. Their amounts are
+// unknown and left zero.
+func (r legacyPositionRecord) upgrade() PositionRecord {
+	rec := r.PositionRecord
+	if len(rec.Exits) > 0 {
+		return rec
+	}
+	for _, id := range r.CloseOrderIDs {
+		rec.Exits = append(rec.Exits, ExitRecord{OrderID: id, TakeProfit: r.TakeProfit, StopLoss: r.StopLoss})
+	}
+	return rec
+}
+
+// ExitRecord is one OCO closing part of a position. OrderID is its
+// take-profit leg; prices are zero when unknown. A Close exit is a plain limit
+// order instead.
+type ExitRecord struct {
+	OrderID    int     `json:"order_id"`
+	Amount     float64 `json:"amount"`
+	TakeProfit float64 `json:"take_profit,omitempty"`
+	StopLoss   float64 `json:"stop_loss,omitempty"`
+	Runner     bool    `json:"runner,omitempty"`
+	Close      bool    `json:"close,omitempty"` // plain limit close rather than an OCO
+}
+
+// EntryOrderRecord is an entry order placed by a buy/sell loop that has not
+// been filled or cancelled yet.
+type EntryOrderRecord struct {
+	Pair     string    `json:"pair"`
+	OrderID  int       `json:"order_id"`
+	Side     string    `json:"side"`
+	Amount   float64   `json:"amount"`
+	Price    float64   `json:"price"`
+	PlacedAt time.Time `json:"placed_at"`
+}
+
+// PairState is the last state a pair's main loop processed.
+type PairState struct {
+	Pair          string    `json:"pair"`
+	LastLoopAt    time.Time `json:"last_loop_at"`
+	PositionCount int       `json:"position_count"`
+	Exposure      float64   `json:"exposure"`
+}
+
+// GuardRecord is the realized PnL tracked against the loss limits, shared by
+// every pair in the process.
+type GuardRecord struct {
+	Day               string    `json:"day"` // trading day DailyPnL belongs to, as YYYY-MM-DD
+	DailyPnL          float64   `json:"daily_pnl"`
+	ConsecutiveLosses int       `json:"consecutive_losses"`
+	TotalPnL          float64   `json:"total_pnl"`
+	PeakPnL           float64   `json:"peak_pnl"`
+	Halted            bool      `json:"halted"`
+	Limit             string    `json:"limit,omitempty"` // limit the halt was tripped by
+	Reason            string    `json:"reason,omitempty"`
+	HaltedAt          time.Time `json:"halted_at,omitempty"`
+	Recorded          []string  `json:"recorded,omitempty"` // pair/position closes already counted, oldest first
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Store is a bbolt-backed state store, safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path, creating its directory.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store '%s': %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{positionsBucket, entryOrdersBucket, stateBucket, guardBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SavePosition creates or replaces a position record.
+func (s *Store) SavePosition(rec PositionRecord) error {
+	rec.UpdatedAt = time.Now()
+	return s.put(positionsBucket, recordKey(rec.Pair, rec.PositionID), rec)
+}
+
+// DeletePosition forgets a position.
+func (s *Store) DeletePosition(pair string, positionID int) error {
+	return s.delete(positionsBucket, recordKey(pair, positionID))
+}
+
+// Positions lists the stored positions of pair, upgrading records in the
+// old layout.
+func (s *Store) Positions(pair string) ([]PositionRecord, error) {
+	var records []PositionRecord
+	err := s.scan(positionsBucket, pair, func(v []byte) error {
+		var rec legacyPositionRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec.upgrade())
+		return nil
+	})
+	return records, err
+}
+
+// SaveEntryOrder records a working entry order.
+func (s *Store) SaveEntryOrder(rec EntryOrderRecord) error {
+	return s.put(entryOrdersBucket, recordKey(rec.Pair, rec.OrderID), rec)
+}
+
+// DeleteEntryOrder forgets an entry order once it is filled or cancelled.
+func (s *Store) DeleteEntryOrder(pair string, orderID int) error {
+	return s.delete(entryOrdersBucket, recordKey(pair, orderID))
+}
+
+// EntryOrders lists the working entry orders of pair.
+func (s *Store) EntryOrders(pair string) ([]EntryOrderRecord, error) {
+	var records []EntryOrderRecord
+	err := s.scan(entryOrdersBucket, pair, func(v []byte) error {
+		var rec EntryOrderRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+	return records, err
+}
+
+// SaveState records the last processed state of a pair.
+func (s *Store) SaveState(state PairState) error {
+	return s.put(stateBucket, []byte(strings.ToUpper(state.Pair)), state)
+}
+
+// State returns the last saved state of pair, and false if there is none.
+func (s *Store) State(pair string) (PairState, bool, error) {
+	var state PairState
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(stateBucket).Get([]byte(strings.ToUpper(pair)))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &state)
+	})
+	return state, found, err
+}
+
+// SaveGuard replaces the loss guard record.
+func (s *Store) SaveGuard(rec GuardRecord) error {
+	rec.UpdatedAt = time.Now()
+	return s.put(guardBucket, guardKey, rec)
+}
+
+// Guard returns the loss guard record, and false if there is none.
+func (s *Store) Guard() (GuardRecord, bool, error) {
+	var rec GuardRecord
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(guardBucket).Get(guardKey)
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &rec)
+	})
+	return rec, found, err
+}
+
+// recordKey orders records by pair, then numerically by ID.
+func recordKey(pair string, id int) []byte {
+	return []byte(fmt.Sprintf("%s/%020d", strings.ToUpper(pair), id))
+}
+
+func (s *Store) put(bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+}
+
+func (s *Store) delete(bucket, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete(key)
+	})
+}
+
+func (s *Store) scan(bucket []byte, pair string, fn func(v []byte) error) error {
+	prefix := []byte(strings.ToUpper(pair) + "/")
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTemp(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "state", "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestPositionsRoundTrip(t *testing.T) {
+	s := openTemp(t)
+	recs := []PositionRecord{
+		{Pair: "BTCIRT", PositionID: 12, Side: "buy", Stop: 95, BreakEven: true, Exits: []ExitRecord{
+			{OrderID: 101, Amount: 0.5, TakeProfit: 110, StopLoss: 95},
+			{OrderID: 102, Amount: 0.5, TakeProfit: 120, StopLoss: 95, Runner: true},
+		}},
+		{Pair: "btcirt", PositionID: 9, Side: "sell", Exits: []ExitRecord{{OrderID: 103, Amount: 1, Close: true}}},
+		{Pair: "ETHIRT", PositionID: 10, Side: "buy"},
+	}
+	for _, rec := range recs {
+		if err := s.SavePosition(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Positions("BTCIRT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pairs match case-insensitively and records come back by position ID.
+	want := []PositionRecord{recs[1], recs[0]}
+	if len(got) != len(want) {
+		t.Fatalf("got %d positions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].UpdatedAt.IsZero() {
+			t.Errorf("position %d has no update time", got[i].PositionID)
+		}
+		got[i].UpdatedAt = time.Time{}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("position %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Saving again replaces the record.
+	recs[0].Exits = recs[0].Exits[1:]
+	if err := s.SavePosition(recs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeletePosition("btcirt", 9); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Positions("BTCIRT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].PositionID != 12 || len(got[0].Exits) != 1 || got[0].Exits[0].OrderID != 102 {
+		t.Fatalf("after replace and delete got %+v", got)
+	}
+	if other, err := s.Positions("ETHIRT"); err != nil || len(other) != 1 {
+		t.Fatalf("ETHIRT positions = %+v, %v", other, err)
+	}
+}
+
+func TestEntryOrdersRoundTrip(t *testing.T) {
+	s := openTemp(t)
+	placed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	recs := []EntryOrderRecord{
+		{Pair: "BTCIRT", OrderID: 2, Side: "buy", Amount: 0.01, Price: 100, PlacedAt: placed},
+		{Pair: "BTCIRT", OrderID: 10, Side: "sell", Amount: 0.02, Price: 101, PlacedAt: placed},
+		{Pair: "BTCIRTX", OrderID: 1, Side: "buy", Amount: 1, Price: 1, PlacedAt: placed},
+	}
+	for _, rec := range recs {
+		if err := s.SaveEntryOrder(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The prefix scan stops at the pair: BTCIRTX is another market.
+	got, err := s.EntryOrders("btcirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, recs[:2]) {
+		t.Fatalf("got %+v, want %+v", got, recs[:2])
+	}
+
+	if err := s.DeleteEntryOrder("BTCIRT", 2); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.EntryOrders("BTCIRT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, recs[1:2]) {
+		t.Fatalf("after delete got %+v, want %+v", got, recs[1:2])
+	}
+}
+
+func TestStateAndGuardRoundTrip(t *testing.T) {
+	s := openTemp(t)
+	if _, found, err := s.State("BTCIRT"); err != nil || found {
+		t.Fatalf("state before save: found %v, err %v", found, err)
+	}
+	if _, found, err := s.Guard(); err != nil || found {
+		t.Fatalf("guard before save: found %v, err %v", found, err)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := PairState{Pair: "btcirt", LastLoopAt: at, PositionCount: 2, Exposure: 1.5e9}
+	if err := s.SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := s.State("BTCIRT")
+	if err != nil || !found || !reflect.DeepEqual(got, state) {
+		t.Fatalf("state = %+v, found %v, err %v", got, found, err)
+	}
+
+	guard := GuardRecord{Day: "2024-05-01", DailyPnL: -5, ConsecutiveLosses: 2, TotalPnL: 10, PeakPnL: 20, Halted: true, Reason: "daily loss", HaltedAt: at}
+	if err := s.SaveGuard(guard); err != nil {
+		t.Fatal(err)
+	}
+	gotGuard, found, err := s.Guard()
+	if err != nil || !found {
+		t.Fatalf("guard: found %v, err %v", found, err)
+	}
+	gotGuard.UpdatedAt = time.Time{}
+	if !reflect.DeepEqual(gotGuard, guard) {
+		t.Fatalf("guard = %+v, want %+v", gotGuard, guard)
+	}
+}
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SavePosition(PositionRecord{Pair: "BTCIRT", PositionID: 1, Side: "buy"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.Positions("BTCIRT")
+	if err != nil || len(got) != 1 || got[0].PositionID != 1 {
+		t.Fatalf("positions after reopen = %+v, %v", got, err)
+	}
+}
+
+func TestPositionsUpgradesLegacyRecords(t *testing.T) {
+	s := openTemp(t)
+	raw := map[string]string{
+		// Written before exits were split into tranches.
+		"BTCIRT/00000000000000000001": `{"pair":"BTCIRT","position_id":1,"side":"buy","close_order_ids":[11,12],"take_profit":110,"stop_loss":95}`,
+		// Already in the current layout: the legacy fields are ignored.
+		"BTCIRT/00000000000000000002": `{"pair":"BTCIRT","position_id":2,"side":"sell","exits":[{"order_id":21,"amount":1,"stop_loss":105}],"close_order_ids":[99]}`,
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for k, v := range raw {
+			if err := tx.Bucket(positionsBucket).Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Positions("BTCIRT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PositionRecord{
+		{Pair: "BTCIRT", PositionID: 1, Side: "buy", Exits: []ExitRecord{
+			{OrderID: 11, TakeProfit: 110, StopLoss: 95},
+			{OrderID: 12, TakeProfit: 110, StopLoss: 95},
+		}},
+		{Pair: "BTCIRT", PositionID: 2, Side: "sell", Exits: []ExitRecord{{OrderID: 21, Amount: 1, StopLoss: 105}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}